@@ -0,0 +1,100 @@
+// zipkin-replay sends spans recorded by zipkin.FileCollector to Kafka or a
+// Zipkin HTTP endpoint.
+//
+//	zipkin-replay -brokers kafka:9092 /var/spool/job/spans.log*
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+var (
+	format    = flag.String("format", "thrift", "Span file format: thrift or json")
+	collector = flag.String("collector", "kafka", "Destination: kafka or http")
+	brokers   = flag.String("brokers", "localhost:9092", "Comma separated Kafka broker list")
+	topic     = flag.String("topic", zipkin.DefaultTopic(), "Kafka topic")
+	url       = flag.String("url", "http://localhost:9411/api/v2/spans", "Zipkin HTTP endpoint")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := replay(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func replay(files []string) error {
+	fileFormat, err := zipkin.FileFormatFromString(*format)
+	if err != nil {
+		return err
+	}
+
+	var collect func(span *zipkincore.Span) error
+	var closeDestination func() error
+	switch *collector {
+	case "kafka":
+		producer, err := zipkin.DefaultProducer(strings.Split(*brokers, ","))
+		if err != nil {
+			return err
+		}
+		collect = zipkin.NewKafkaCollector(producer, *topic, zipkin.ThriftEncoder{}).Collect
+		closeDestination = func() error {
+			producer.Close()
+			return nil
+		}
+	case "http":
+		httpCollector, err := zipkin.NewHTTPCollector(zipkin.NewHTTPCollectorConfig(*url))
+		if err != nil {
+			return err
+		}
+		collect = func(span *zipkincore.Span) error {
+			err := httpCollector.Collect(span)
+			for err == zipkin.ErrQueueFull {
+				// spans are read faster than they are sent, send the queue first
+				if err := httpCollector.Flush(); err != nil {
+					return err
+				}
+				err = httpCollector.Collect(span)
+			}
+			return err
+		}
+		closeDestination = httpCollector.Close
+	default:
+		return fmt.Errorf("Unknown collector %s", *collector)
+	}
+
+	zipkin.SortSpanFiles(files)
+
+	count := 0
+	for _, file := range files {
+		err := zipkin.ReadSpanFile(file, fileFormat, func(span *zipkincore.Span) error {
+			count++
+			return collect(span)
+		})
+		if err != nil {
+			closeDestination()
+			return fmt.Errorf("Unable to replay %s: %s", file, err)
+		}
+	}
+	if err := closeDestination(); err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %d spans from %d files\n", count, len(files))
+	return nil
+}
@@ -0,0 +1,126 @@
+package zipkin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+// Compressor compresses the payloads a collector sends, see
+// HTTPCollectorConfig.Compressor and KafkaCollector.SetCompression.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	// ContentEncoding is the HTTP Content-Encoding of the compressed payload.
+	ContentEncoding() string
+}
+
+// DefaultCompressionThreshold is the payload size in bytes below which
+// compression usually costs more than it saves. Single spans rarely reach
+// it, KafkaCollector needs SetBatching for compression to pay off.
+const DefaultCompressionThreshold = 1024
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// GzipCompressor compresses with gzip at Level, zero meaning gzip.DefaultCompression.
+type GzipCompressor struct {
+	Level int
+}
+
+func (gc GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := gc.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (GzipCompressor) ContentEncoding() string {
+	return "gzip"
+}
+
+// SnappyCompressor compresses with the snappy framing format. Zipkin servers
+// accept gzip only over HTTP, snappy is meant for Kafka.
+type SnappyCompressor struct{}
+
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := snappy.NewBufferedWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (SnappyCompressor) ContentEncoding() string {
+	return "snappy"
+}
+
+// Decompress detects gzip and framed snappy payloads by their magic bytes
+// and decompresses them. Other payloads are returned as they are, so
+// consumers can read topics mixing compressed and uncompressed spans.
+// Payloads decompressing to more than MaxSpanMessageSize bytes fail with
+// ErrSpanMessageTooLarge.
+func Decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader)
+	case bytes.HasPrefix(data, snappyMagic):
+		return readLimited(snappy.NewReader(bytes.NewReader(data)))
+	}
+	return data, nil
+}
+
+// readLimited reads at most MaxSpanMessageSize bytes, so a small compressed
+// payload can't expand into an arbitrary amount of memory.
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, MaxSpanMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSpanMessageSize {
+		return nil, ErrSpanMessageTooLarge
+	}
+	return data, nil
+}
+
+// compress applies the compressor to payloads of at least threshold bytes
+// and returns the content encoding used, empty if the payload is left as is.
+func compress(compressor Compressor, threshold int, data []byte) ([]byte, string, error) {
+	if compressor == nil || len(data) < threshold {
+		return data, "", nil
+	}
+	compressed, err := compressor.Compress(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if compressed == nil {
+		return nil, "", errors.New("Compressor returned no payload")
+	}
+	return compressed, compressor.ContentEncoding(), nil
+}
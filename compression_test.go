@@ -0,0 +1,46 @@
+package zipkin
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("span"), 1024)
+	for _, compressor := range []Compressor{GzipCompressor{}, SnappyCompressor{}} {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: %s", compressor.ContentEncoding(), err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: payload changed", compressor.ContentEncoding())
+		}
+	}
+	if plain, err := Decompress(data); err != nil || !bytes.Equal(plain, data) {
+		t.Errorf("Uncompressed payload changed: %v", err)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	bomb := make([]byte, MaxSpanMessageSize+1)
+	for _, compressor := range []Compressor{GzipCompressor{}, SnappyCompressor{}} {
+		compressed, err := compressor.Compress(bomb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Decompress(compressed); err != ErrSpanMessageTooLarge {
+			t.Errorf("%s: expected ErrSpanMessageTooLarge, got %v", compressor.ContentEncoding(), err)
+		}
+		compressed, err = compressor.Compress(bomb[:MaxSpanMessageSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := Decompress(compressed); err != nil || len(data) != MaxSpanMessageSize {
+			t.Errorf("%s: payload of the maximum size rejected: %v", compressor.ContentEncoding(), err)
+		}
+	}
+}
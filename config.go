@@ -0,0 +1,253 @@
+package zipkin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	CollectorKafka = "kafka"
+	CollectorHTTP  = "http"
+	CollectorFile  = "file"
+	CollectorNoop  = "noop"
+)
+
+// Config describes a tracer, see NewTracerFromConfig. It is read from
+// ZIPKIN_* environment variables by ConfigFromEnv or from a YAML or JSON file
+// by LoadConfig, using the field names given in the tags.
+type Config struct {
+	// Collector is one of kafka, http, file or noop.
+	Collector string `json:"collector" yaml:"collector"`
+	// SampleRate is the fraction of traces sampled, between 0 and 1.
+	SampleRate float64  `json:"sample_rate" yaml:"sample_rate"`
+	Brokers    []string `json:"brokers" yaml:"brokers"`
+	Topic      string   `json:"topic" yaml:"topic"`
+	// PartitionByTraceID keys kafka records by trace id, see TraceIDPartitionKey.
+	PartitionByTraceID bool   `json:"partition_by_trace_id" yaml:"partition_by_trace_id"`
+	HTTPEndpoint       string `json:"http_endpoint" yaml:"http_endpoint"`
+	FilePath           string `json:"file_path" yaml:"file_path"`
+	FileFormat         string `json:"file_format" yaml:"file_format"`
+	// IP and Port are reported in annotations, IP defaults to LocalNetworkIP().
+	IP   string `json:"ip" yaml:"ip"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Collector:  CollectorKafka,
+		SampleRate: 1,
+		Topic:      DefaultTopic(),
+		FileFormat: "thrift",
+		Port:       int(DefaultPort()),
+	}
+}
+
+// ConfigFromEnv starts with the file named by ZIPKIN_CONFIG_FILE, if any, or
+// DefaultConfig and overrides it with the ZIPKIN_COLLECTOR, ZIPKIN_SAMPLE_RATE,
+// ZIPKIN_BROKERS (comma separated), ZIPKIN_TOPIC, ZIPKIN_PARTITION_BY_TRACE_ID,
+// ZIPKIN_HTTP_ENDPOINT, ZIPKIN_FILE_PATH, ZIPKIN_FILE_FORMAT, ZIPKIN_IP and
+// ZIPKIN_PORT variables. The result is validated once all of them are applied,
+// so the variables may complete a partial file.
+func ConfigFromEnv() (*Config, error) {
+	config := DefaultConfig()
+	if path := os.Getenv("ZIPKIN_CONFIG_FILE"); path != "" {
+		var err error
+		// validated below, once the variables had a chance to complete it
+		if config, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, ok := lookupEnv("ZIPKIN_COLLECTOR"); ok {
+		config.Collector = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_SAMPLE_RATE"); ok {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ZIPKIN_SAMPLE_RATE %q: not a number", value)
+		}
+		config.SampleRate = rate
+	}
+	if value, ok := lookupEnv("ZIPKIN_BROKERS"); ok {
+		config.Brokers = nil
+		for _, broker := range strings.Split(value, ",") {
+			if broker = strings.TrimSpace(broker); broker != "" {
+				config.Brokers = append(config.Brokers, broker)
+			}
+		}
+	}
+	if value, ok := lookupEnv("ZIPKIN_TOPIC"); ok {
+		config.Topic = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_PARTITION_BY_TRACE_ID"); ok {
+		partition, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ZIPKIN_PARTITION_BY_TRACE_ID %q: not a boolean", value)
+		}
+		config.PartitionByTraceID = partition
+	}
+	if value, ok := lookupEnv("ZIPKIN_HTTP_ENDPOINT"); ok {
+		config.HTTPEndpoint = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_FILE_PATH"); ok {
+		config.FilePath = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_FILE_FORMAT"); ok {
+		config.FileFormat = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_IP"); ok {
+		config.IP = value
+	}
+	if value, ok := lookupEnv("ZIPKIN_PORT"); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ZIPKIN_PORT %q: not a number", value)
+		}
+		config.Port = port
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid zipkin environment configuration: %s", err)
+	}
+	return config, nil
+}
+
+// LoadConfig reads a YAML (.yaml, .yml) or JSON (.json) config file. Fields
+// missing from the file keep their DefaultConfig values.
+func LoadConfig(path string) (*Config, error) {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid zipkin config file %s: %s", path, err)
+	}
+	return config, nil
+}
+
+func readConfigFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := DefaultConfig()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, config)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	default:
+		return nil, fmt.Errorf("Unknown zipkin config file type %s, expected .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse zipkin config file %s: %s", path, err)
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("sample rate %v must be between 0 and 1", c.SampleRate)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d must be between 0 and 65535", c.Port)
+	}
+	if c.IP != "" {
+		if _, err := parseIPv4(c.IP); err != nil {
+			return err
+		}
+	}
+	switch c.Collector {
+	case CollectorKafka:
+		if len(c.Brokers) == 0 {
+			return errors.New("kafka collector requires brokers")
+		}
+		if c.Topic == "" {
+			return errors.New("kafka collector requires a topic")
+		}
+	case CollectorHTTP:
+		if c.HTTPEndpoint == "" {
+			return errors.New("http collector requires an http endpoint")
+		}
+	case CollectorFile:
+		if c.FilePath == "" {
+			return errors.New("file collector requires a file path")
+		}
+		if _, err := FileFormatFromString(c.FileFormat); err != nil {
+			return err
+		}
+	case CollectorNoop:
+	default:
+		return fmt.Errorf("unknown collector %q, expected kafka, http, file or noop", c.Collector)
+	}
+	return nil
+}
+
+// NewCollector creates the collector the config describes.
+func (c *Config) NewCollector() (Collector, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Collector {
+	case CollectorKafka:
+		producer, err := DefaultProducer(c.Brokers)
+		if err != nil {
+			return nil, err
+		}
+		collector := NewKafkaCollector(producer, c.Topic, ThriftEncoder{})
+		if c.PartitionByTraceID {
+			collector.SetPartitionKey(TraceIDPartitionKey)
+		}
+		return collector, nil
+	case CollectorHTTP:
+		return NewHTTPCollector(NewHTTPCollectorConfig(c.HTTPEndpoint))
+	case CollectorFile:
+		fileConfig := NewFileCollectorConfig(c.FilePath)
+		fileConfig.Format, _ = FileFormatFromString(c.FileFormat)
+		return NewFileCollector(fileConfig)
+	}
+	return NoopCollector{}, nil
+}
+
+func NewTracerFromConfig(serviceName string, config *Config) (*Tracer, error) {
+	collector, err := config.NewCollector()
+	if err != nil {
+		return nil, err
+	}
+	return NewTracerWithOptions(serviceName,
+		WithCollector(collector),
+		WithSampler(NewProbabilitySampler(config.SampleRate)),
+		WithEndpoint(config.IP, int16(config.Port)),
+	), nil
+}
+
+func NewTracerFromEnv(serviceName string) (*Tracer, error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewTracerFromConfig(serviceName, config)
+}
+
+func NewTracerFromFile(serviceName string, path string) (*Tracer, error) {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTracerFromConfig(serviceName, config)
+}
+
+func lookupEnv(key string) (string, bool) {
+	value, ok := os.LookupEnv(key)
+	return strings.TrimSpace(value), ok && strings.TrimSpace(value) != ""
+}
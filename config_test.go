@@ -0,0 +1,60 @@
+package zipkin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "zipkin-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "zipkin.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func setEnv(t *testing.T, values map[string]string) func() {
+	for key, value := range values {
+		if err := os.Setenv(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for key := range values {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestConfigFromEnvCompletesFile(t *testing.T) {
+	// the file alone is invalid, the kafka collector lacks brokers
+	path, remove := writeConfigFile(t, "collector: kafka\ntopic: traces\n")
+	defer remove()
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("LoadConfig accepted a kafka config without brokers")
+	}
+
+	defer setEnv(t, map[string]string{"ZIPKIN_CONFIG_FILE": path, "ZIPKIN_BROKERS": "kafka1:9092, kafka2:9092"})()
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Topic != "traces" || len(config.Brokers) != 2 || config.Brokers[1] != "kafka2:9092" {
+		t.Errorf("Unexpected config %+v", config)
+	}
+}
+
+func TestConfigFromEnvValidatesResult(t *testing.T) {
+	path, remove := writeConfigFile(t, "collector: noop\n")
+	defer remove()
+	defer setEnv(t, map[string]string{"ZIPKIN_CONFIG_FILE": path, "ZIPKIN_COLLECTOR": "http"})()
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv accepted an http collector without endpoint")
+	}
+}
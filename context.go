@@ -0,0 +1,17 @@
+package zipkin
+
+import "context"
+
+type spanContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the span, for instrumentation
+// such as zipkinhttp to hand spans to handlers and outgoing calls.
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span stored by NewContext or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
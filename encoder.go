@@ -0,0 +1,55 @@
+package zipkin
+
+import "github.com/elodina/go-zipkin/gen-go/zipkincore"
+
+// SpanEncoder turns spans into the wire payload a collector sends.
+type SpanEncoder interface {
+	EncodeSpan(span *zipkincore.Span) ([]byte, error)
+	EncodeSpans(spans []*zipkincore.Span) ([]byte, error)
+	ContentType() string
+}
+
+type ThriftEncoder struct{}
+
+func (ThriftEncoder) EncodeSpan(span *zipkincore.Span) ([]byte, error) {
+	return SerializeSpan(span)
+}
+
+func (ThriftEncoder) EncodeSpans(spans []*zipkincore.Span) ([]byte, error) {
+	return SerializeSpanList(spans)
+}
+
+func (ThriftEncoder) ContentType() string {
+	return "application/x-thrift"
+}
+
+// CompactThriftEncoder writes spans with the Thrift compact protocol.
+// DeserializeSpan and DeserializeSpanList detect it, Zipkin servers accept
+// binary Thrift only.
+type CompactThriftEncoder struct{}
+
+func (CompactThriftEncoder) EncodeSpan(span *zipkincore.Span) ([]byte, error) {
+	return SerializeSpanCompact(span)
+}
+
+func (CompactThriftEncoder) EncodeSpans(spans []*zipkincore.Span) ([]byte, error) {
+	return SerializeSpanListCompact(spans)
+}
+
+func (CompactThriftEncoder) ContentType() string {
+	return "application/vnd.apache.thrift.compact"
+}
+
+type JSONEncoder struct{}
+
+func (JSONEncoder) EncodeSpan(span *zipkincore.Span) ([]byte, error) {
+	return SerializeSpanJSON(span)
+}
+
+func (JSONEncoder) EncodeSpans(spans []*zipkincore.Span) ([]byte, error) {
+	return SerializeSpanListJSON(spans)
+}
+
+func (JSONEncoder) ContentType() string {
+	return "application/json"
+}
@@ -0,0 +1,66 @@
+package zipkin
+
+import (
+	"expvar"
+	"time"
+)
+
+// ExpvarMetrics publishes metrics as an expvar map, served as JSON on
+// /debug/vars by the expvar package.
+type ExpvarMetrics struct {
+	vars       *expvar.Map
+	dropped    *expvar.Map
+	queueDepth *expvar.Int
+}
+
+// NewExpvarMetrics publishes the metrics under the given name. Like
+// expvar.Publish it panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	em := &ExpvarMetrics{
+		vars:       expvar.NewMap(name),
+		dropped:    new(expvar.Map).Init(),
+		queueDepth: new(expvar.Int),
+	}
+	em.vars.Set("spans_dropped", em.dropped)
+	em.vars.Set("queue_depth", em.queueDepth)
+	for _, key := range []string{"spans_started", "spans_sampled", "spans_finished", "spans_collected", "bytes_sent",
+		"collect_count", "collect_latency_us"} {
+		em.vars.Add(key, 0)
+	}
+	return em
+}
+
+func (em *ExpvarMetrics) SpanStarted() {
+	em.vars.Add("spans_started", 1)
+}
+
+func (em *ExpvarMetrics) SpanSampled() {
+	em.vars.Add("spans_sampled", 1)
+}
+
+func (em *ExpvarMetrics) SpanFinished() {
+	em.vars.Add("spans_finished", 1)
+}
+
+func (em *ExpvarMetrics) SpansCollected(count int) {
+	em.vars.Add("spans_collected", int64(count))
+}
+
+func (em *ExpvarMetrics) SpansDropped(reason DropReason, count int) {
+	em.dropped.Add(string(reason), int64(count))
+}
+
+func (em *ExpvarMetrics) BytesSent(bytes int) {
+	em.vars.Add("bytes_sent", int64(bytes))
+}
+
+func (em *ExpvarMetrics) QueueDepth(depth int) {
+	em.queueDepth.Set(int64(depth))
+}
+
+// CollectLatency adds up latencies in collect_latency_us, divide it by
+// collect_count for the average.
+func (em *ExpvarMetrics) CollectLatency(latency time.Duration) {
+	em.vars.Add("collect_count", 1)
+	em.vars.Add("collect_latency_us", int64(latency/time.Microsecond))
+}
@@ -0,0 +1,292 @@
+package zipkin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+type FileFormat int
+
+const (
+	// FileFormatThrift stores binary Thrift spans, each prefixed with its
+	// length as a big endian uint32.
+	FileFormatThrift FileFormat = iota
+	// FileFormatJSON stores Zipkin v1 JSON spans, one per line.
+	FileFormatJSON
+)
+
+// rotationLayout formats the rotation time suffixed to rotated files.
+const rotationLayout = "20060102T150405.000000000"
+
+// maxFileRecordSize protects readers from corrupt length prefixes.
+const maxFileRecordSize = 16 * 1024 * 1024
+
+func FileFormatFromString(s string) (FileFormat, error) {
+	switch s {
+	case "thrift":
+		return FileFormatThrift, nil
+	case "json", "ndjson":
+		return FileFormatJSON, nil
+	}
+	return FileFormatThrift, fmt.Errorf("Unknown span file format %s", s)
+}
+
+type FileCollectorConfig struct {
+	Path   string
+	Format FileFormat
+	// The current file is rotated once it grows beyond MaxSize bytes or has
+	// been open for MaxAge. Zero disables the corresponding limit.
+	MaxSize int64
+	MaxAge  time.Duration
+	// Metrics receives the spans and bytes written.
+	Metrics Metrics
+}
+
+func NewFileCollectorConfig(path string) *FileCollectorConfig {
+	return &FileCollectorConfig{
+		Path:    path,
+		Format:  FileFormatThrift,
+		MaxSize: 100 * 1024 * 1024,
+		MaxAge:  24 * time.Hour,
+		Metrics: NoopMetrics{},
+	}
+}
+
+// FileCollector appends spans to a local file so that traces of jobs without
+// access to Kafka can be replayed later, see cmd/zipkin-replay. Rotated files
+// are renamed to Path suffixed with the rotation time.
+type FileCollector struct {
+	config *FileCollectorConfig
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func NewFileCollector(config *FileCollectorConfig) (*FileCollector, error) {
+	if config.Path == "" {
+		return nil, errors.New("File collector path is required")
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+	fc := &FileCollector{config: config}
+	if err := fc.open(); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+func (fc *FileCollector) Collect(span *zipkincore.Span) error {
+	record, err := fc.encode(span)
+	if err != nil {
+		return err
+	}
+
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	if fc.file == nil {
+		return errors.New("File collector is closed")
+	}
+	if fc.needsRotation() {
+		if err := fc.rotate(); err != nil {
+			// rather write an oversized file than drop the span
+			log.Warningf("[Zipkin] Unable to rotate span file %s: %s", fc.config.Path, err)
+		}
+	}
+	n, err := fc.file.Write(record)
+	fc.size += int64(n)
+	if err != nil {
+		return err
+	}
+	fc.config.Metrics.BytesSent(n)
+	fc.config.Metrics.SpansCollected(1)
+	return nil
+}
+
+func (fc *FileCollector) Close() error {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	if fc.file == nil {
+		return nil
+	}
+	err := fc.file.Close()
+	fc.file = nil
+	return err
+}
+
+func (fc *FileCollector) encode(span *zipkincore.Span) ([]byte, error) {
+	switch fc.config.Format {
+	case FileFormatThrift:
+		bytes, err := SerializeSpan(span)
+		if err != nil {
+			return nil, err
+		}
+		record := make([]byte, 4+len(bytes))
+		binary.BigEndian.PutUint32(record, uint32(len(bytes)))
+		copy(record[4:], bytes)
+		return record, nil
+	case FileFormatJSON:
+		bytes, err := SerializeSpanJSON(span)
+		if err != nil {
+			return nil, err
+		}
+		return append(bytes, '\n'), nil
+	}
+	return nil, fmt.Errorf("Unknown span file format %d", fc.config.Format)
+}
+
+func (fc *FileCollector) needsRotation() bool {
+	if fc.size == 0 {
+		return false
+	}
+	if fc.config.MaxSize > 0 && fc.size >= fc.config.MaxSize {
+		return true
+	}
+	return fc.config.MaxAge > 0 && time.Since(fc.opened) >= fc.config.MaxAge
+}
+
+// renameFile is replaced by tests to make rotation fail.
+var renameFile = os.Rename
+
+// rotate renames the current file before opening a new one at Path. The
+// file is only closed once its successor is open, so a failed rename or open
+// never leaves the collector without a file to write to.
+func (fc *FileCollector) rotate() error {
+	rotated := fc.config.Path + "." + time.Now().Format(rotationLayout)
+	log.Infof("[Zipkin] Rotating span file %s to %s", fc.config.Path, rotated)
+	renameErr := renameFile(fc.config.Path, rotated)
+	if renameErr != nil {
+		// reopen Path, which recreates the file if it has been removed
+		rotated = fc.config.Path
+	}
+	current := fc.file
+	if err := fc.open(); err != nil {
+		// keep appending to the file open until a new one can be opened
+		return err
+	}
+	if err := current.Close(); err != nil {
+		log.Warningf("[Zipkin] Unable to close span file %s: %s", rotated, err)
+	}
+	return renameErr
+}
+
+func (fc *FileCollector) open() error {
+	file, err := os.OpenFile(fc.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	fc.file = file
+	fc.size = info.Size()
+	fc.opened = time.Now()
+	return nil
+}
+
+// SortSpanFiles orders files written by FileCollector for replay: rotated
+// files by their rotation time, followed by the current files.
+func SortSpanFiles(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		rotatedI, okI := rotationTime(files[i])
+		rotatedJ, okJ := rotationTime(files[j])
+		if okI && okJ {
+			return rotatedI.Before(rotatedJ)
+		}
+		if okI != okJ {
+			return okI
+		}
+		return files[i] < files[j]
+	})
+}
+
+// rotationTime parses the suffix rotate appends to the file name.
+func rotationTime(path string) (time.Time, bool) {
+	suffix := len(path) - len(rotationLayout)
+	if suffix < 1 || path[suffix-1] != '.' {
+		return time.Time{}, false
+	}
+	rotated, err := time.Parse(rotationLayout, path[suffix:])
+	return rotated, err == nil
+}
+
+// ReadSpanFile reads a file written by FileCollector and hands every span to
+// the given function, stopping at the first error.
+func ReadSpanFile(path string, format FileFormat, handle func(*zipkincore.Span) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return ReadSpans(file, format, handle)
+}
+
+func ReadSpans(reader io.Reader, format FileFormat, handle func(*zipkincore.Span) error) error {
+	switch format {
+	case FileFormatThrift:
+		return readThriftSpans(bufio.NewReader(reader), handle)
+	case FileFormatJSON:
+		return readJSONSpans(reader, handle)
+	}
+	return fmt.Errorf("Unknown span file format %d", format)
+}
+
+func readThriftSpans(reader io.Reader, handle func(*zipkincore.Span) error) error {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxFileRecordSize {
+			return fmt.Errorf("Span record of %d bytes exceeds the limit of %d bytes", size, maxFileRecordSize)
+		}
+		record := make([]byte, size)
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return err
+		}
+		span, err := DeserializeSpan(record)
+		if err != nil {
+			return err
+		}
+		if err := handle(span); err != nil {
+			return err
+		}
+	}
+}
+
+func readJSONSpans(reader io.Reader, handle func(*zipkincore.Span) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxFileRecordSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		span, err := DeserializeSpanJSON(line)
+		if err != nil {
+			return err
+		}
+		if err := handle(span); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,159 @@
+package zipkin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+func TestSortSpanFiles(t *testing.T) {
+	files := []string{
+		"/spool/spans.log",
+		"/spool/spans.log.20170102T030405.000000000",
+		"/spool/spans.log.20161231T235959.999999999",
+		"/spool/other/spans.log.20170101T000000.000000000",
+	}
+	SortSpanFiles(files)
+	expected := []string{
+		"/spool/spans.log.20161231T235959.999999999",
+		"/spool/other/spans.log.20170101T000000.000000000",
+		"/spool/spans.log.20170102T030405.000000000",
+		"/spool/spans.log",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestFileCollectorRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := NewFileCollectorConfig(filepath.Join(dir, "spans.log"))
+	config.MaxSize = 1
+	collector, err := NewFileCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := collector.Collect(&zipkincore.Span{ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(config.Path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortSpanFiles(files)
+	var ids []int64
+	for _, file := range files {
+		err := ReadSpanFile(file, FileFormatThrift, func(span *zipkincore.Span) error {
+			ids = append(ids, span.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(files) != 3 || !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("Expected spans 1 to 3 in 3 files, got %v in %v", ids, files)
+	}
+}
+
+func TestFileCollectorFailedRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := NewFileCollectorConfig(filepath.Join(dir, "spans.log"))
+	config.MaxSize = 1
+	collector, err := NewFileCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+	if err := collector.Collect(&zipkincore.Span{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// the rename fails while the file is gone
+	if err := os.Remove(config.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	collector.lock.Lock()
+	alive := collector.file != nil
+	collector.lock.Unlock()
+	if !alive {
+		t.Fatal("Failed rotation closed the collector")
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(config.Path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortSpanFiles(files)
+	var ids []int64
+	for _, file := range files {
+		ReadSpanFile(file, FileFormatThrift, func(span *zipkincore.Span) error {
+			ids = append(ids, span.ID)
+			return nil
+		})
+	}
+	if !reflect.DeepEqual(ids, []int64{2, 3}) {
+		t.Errorf("Expected the recreated files to hold spans 2 and 3, got %v", ids)
+	}
+}
+
+func TestFileCollectorKeepsWritingWhileRenameFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	renameFile = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrPermission}
+	}
+	defer func() { renameFile = os.Rename }()
+
+	config := NewFileCollectorConfig(filepath.Join(dir, "spans.log"))
+	config.MaxSize = 1
+	collector, err := NewFileCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := collector.Collect(&zipkincore.Span{ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	err = ReadSpanFile(config.Path, FileFormatThrift, func(span *zipkincore.Span) error {
+		ids = append(ids, span.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("Expected spans 1 to 3 in the unrotated file, got %v", ids)
+	}
+}
@@ -0,0 +1,35 @@
+module github.com/elodina/go-zipkin
+
+go 1.21
+
+// TODO: pin github.com/elodina/siesta, github.com/elodina/siesta-producer and
+// github.com/yanzay/log. They have no tagged releases and are not required
+// below yet, so a clean checkout builds only after
+//   go get github.com/elodina/siesta@master github.com/elodina/siesta-producer@master github.com/yanzay/log@master
+//   go mod tidy
+// which resolves their pseudo-versions and go.sum hashes.
+
+require (
+	git.apache.org/thrift.git v0.0.0-20161221203622-b2a4d4ae21c7
+	github.com/elodina/go-avro v0.0.0-20160406082632-0c8185d9a3ba
+	github.com/golang/snappy v1.0.0
+	github.com/opentracing/opentracing-go v1.2.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+	google.golang.org/grpc v1.62.1
+	google.golang.org/protobuf v1.32.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240123012728-ef4313101c80 // indirect
+)
+
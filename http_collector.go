@@ -0,0 +1,225 @@
+package zipkin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+type HTTPCollectorConfig struct {
+	// URL of the collector endpoint, e.g. http://zipkin:9411/api/v2/spans for Proto3Encoder.
+	URL           string
+	Encoder       SpanEncoder
+	BatchSize     int
+	BatchInterval time.Duration
+	// QueueSize bounds the spans buffered while batches are being sent,
+	// Collect fails with ErrQueueFull beyond it. Zero means ten batches.
+	QueueSize int
+	Client    *http.Client
+	// Compressor, if set, compresses payloads of at least CompressionThreshold
+	// bytes and sets the Content-Encoding header accordingly.
+	Compressor           Compressor
+	CompressionThreshold int
+	// Metrics receives the bytes sent, the batch size and spans lost by failed sends.
+	Metrics Metrics
+}
+
+func NewHTTPCollectorConfig(url string) *HTTPCollectorConfig {
+	return &HTTPCollectorConfig{
+		URL:                  url,
+		Encoder:              Proto3Encoder{},
+		BatchSize:            100,
+		BatchInterval:        time.Second,
+		QueueSize:            1000,
+		Client:               &http.Client{Timeout: 5 * time.Second},
+		CompressionThreshold: DefaultCompressionThreshold,
+		Metrics:              NoopMetrics{},
+	}
+}
+
+// HTTPCollector batches spans and POSTs them to a Zipkin HTTP endpoint.
+// Batches are sent in the background once BatchSize spans are buffered or
+// BatchInterval passes, Collect only buffers the span.
+type HTTPCollector struct {
+	config *HTTPCollectorConfig
+
+	lock    sync.Mutex
+	batch   []*zipkincore.Span
+	closing bool
+
+	// full wakes the send loop once a batch is complete
+	full      chan struct{}
+	close     chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	closed    sync.WaitGroup
+}
+
+func NewHTTPCollector(config *HTTPCollectorConfig) (*HTTPCollector, error) {
+	if config.URL == "" {
+		return nil, errors.New("HTTP collector URL is required")
+	}
+	if config.Encoder == nil {
+		return nil, errors.New("HTTP collector encoder is required")
+	}
+	if config.BatchSize <= 0 {
+		return nil, errors.New("HTTP collector batch size must be positive")
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 10 * config.BatchSize
+	}
+	if config.QueueSize < config.BatchSize {
+		return nil, errors.New("HTTP collector queue size must not be smaller than the batch size")
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+
+	hc := &HTTPCollector{
+		config: config,
+		batch:  make([]*zipkincore.Span, 0, config.BatchSize),
+		full:   make(chan struct{}, 1),
+		close:  make(chan struct{}),
+	}
+	hc.closed.Add(1)
+	go hc.flushLoop()
+	return hc, nil
+}
+
+// Collect buffers the span for the next batch. It fails with ErrQueueFull if
+// QueueSize spans are waiting to be sent already.
+func (hc *HTTPCollector) Collect(span *zipkincore.Span) error {
+	hc.lock.Lock()
+	if hc.closing {
+		hc.lock.Unlock()
+		return errors.New("HTTP collector is closed")
+	}
+	if len(hc.batch) >= hc.config.QueueSize {
+		hc.lock.Unlock()
+		return ErrQueueFull
+	}
+	hc.batch = append(hc.batch, span)
+	depth := len(hc.batch)
+	hc.lock.Unlock()
+	hc.config.Metrics.QueueDepth(depth)
+
+	if depth >= hc.config.BatchSize {
+		select {
+		case hc.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush sends all buffered spans in batches of at most BatchSize spans and
+// returns the first error. Spans of failed batches are dropped.
+func (hc *HTTPCollector) Flush() error {
+	var flushErr error
+	for {
+		batch := hc.nextBatch()
+		if len(batch) == 0 {
+			return flushErr
+		}
+		if err := hc.send(batch); err != nil {
+			hc.config.Metrics.SpansDropped(DropReasonCollectorError, len(batch))
+			if flushErr == nil {
+				flushErr = err
+			}
+		}
+	}
+}
+
+// nextBatch takes up to BatchSize spans from the buffer.
+func (hc *HTTPCollector) nextBatch() []*zipkincore.Span {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	size := len(hc.batch)
+	if size > hc.config.BatchSize {
+		size = hc.config.BatchSize
+	}
+	batch := make([]*zipkincore.Span, size)
+	copy(batch, hc.batch)
+	hc.batch = append(hc.batch[:0], hc.batch[size:]...)
+	hc.config.Metrics.QueueDepth(len(hc.batch))
+	return batch
+}
+
+// Close stops the background sending and sends whatever is still buffered.
+// Later calls do nothing.
+func (hc *HTTPCollector) Close() error {
+	hc.closeOnce.Do(func() {
+		hc.lock.Lock()
+		hc.closing = true
+		hc.lock.Unlock()
+		close(hc.close)
+		hc.closed.Wait()
+		hc.closeErr = hc.Flush()
+	})
+	return hc.closeErr
+}
+
+func (hc *HTTPCollector) flushLoop() {
+	defer hc.closed.Done()
+	var tick <-chan time.Time
+	if hc.config.BatchInterval > 0 {
+		ticker := time.NewTicker(hc.config.BatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-hc.full:
+		case <-hc.close:
+			return
+		}
+		if err := hc.Flush(); err != nil {
+			log.Warningf("[Zipkin] Unable to send spans to %s: %s", hc.config.URL, err)
+		}
+	}
+}
+
+func (hc *HTTPCollector) send(spans []*zipkincore.Span) error {
+	body, err := hc.config.Encoder.EncodeSpans(spans)
+	if err != nil {
+		return err
+	}
+	body, encoding, err := compress(hc.config.Compressor, hc.config.CompressionThreshold, body)
+	if err != nil {
+		return err
+	}
+	log.Debugf("[Zipkin] Sending %d spans to %s", len(spans), hc.config.URL)
+	req, err := http.NewRequest("POST", hc.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", hc.config.Encoder.ContentType())
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := hc.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Zipkin collector %s responded with %s", hc.config.URL, resp.Status)
+	}
+	hc.config.Metrics.BytesSent(len(body))
+	hc.config.Metrics.SpansCollected(len(spans))
+	return nil
+}
@@ -0,0 +1,227 @@
+package zipkin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// recordingServer counts the spans POSTed to it, holding requests while blocked.
+type recordingServer struct {
+	*httptest.Server
+	lock    sync.Mutex
+	batches []int
+	block   chan struct{}
+}
+
+func newRecordingServer(t *testing.T, blocked bool) *recordingServer {
+	rs := &recordingServer{block: make(chan struct{})}
+	if !blocked {
+		close(rs.block)
+	}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-rs.block
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		spans, err := DeserializeSpanList(body)
+		if err != nil {
+			t.Error(err)
+		}
+		rs.lock.Lock()
+		rs.batches = append(rs.batches, len(spans))
+		rs.lock.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return rs
+}
+
+func (rs *recordingServer) received() []int {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return append([]int(nil), rs.batches...)
+}
+
+func newTestHTTPCollector(t *testing.T, url string, batchSize, queueSize int) *HTTPCollector {
+	config := NewHTTPCollectorConfig(url)
+	config.Encoder = ThriftEncoder{}
+	config.BatchSize = batchSize
+	config.QueueSize = queueSize
+	config.BatchInterval = 0
+	collector, err := NewHTTPCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector
+}
+
+func TestHTTPCollectorSendsFullBatchesInBackground(t *testing.T) {
+	server := newRecordingServer(t, true)
+	defer server.Close()
+	collector := newTestHTTPCollector(t, server.URL, 2, 4)
+
+	// the server blocks, Collect must return without waiting for it
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			if err := collector.Collect(&zipkincore.Span{ID: int64(i)}); err != nil {
+				t.Error(err)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Collect blocked on a full batch")
+	}
+	close(server.block)
+
+	deadline := time.Now().Add(time.Second)
+	for len(server.received()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if batches := server.received(); len(batches) != 2 || batches[0] != 2 || batches[1] != 2 {
+		t.Errorf("Expected two batches of 2 spans, got %v", batches)
+	}
+	if err := collector.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTPCollectorQueueFull(t *testing.T) {
+	server := newRecordingServer(t, true)
+	defer server.Close()
+	collector := newTestHTTPCollector(t, server.URL, 2, 2)
+
+	collector.Collect(&zipkincore.Span{ID: 1})
+	collector.Collect(&zipkincore.Span{ID: 2})
+	// wait for the send loop to take the full batch, blocking on the server
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		collector.lock.Lock()
+		depth := len(collector.batch)
+		collector.lock.Unlock()
+		if depth == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	collector.Collect(&zipkincore.Span{ID: 3})
+	collector.Collect(&zipkincore.Span{ID: 4})
+	if err := collector.Collect(&zipkincore.Span{ID: 5}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	close(server.block)
+	collector.Close()
+	if batches := server.received(); len(batches) != 2 {
+		t.Errorf("Expected two batches, got %v", batches)
+	}
+}
+
+func TestHTTPCollectorCloseTwice(t *testing.T) {
+	server := newRecordingServer(t, false)
+	defer server.Close()
+	collector := newTestHTTPCollector(t, server.URL, 10, 0)
+	collector.Collect(&zipkincore.Span{ID: 1})
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if batches := server.received(); len(batches) != 1 || batches[0] != 1 {
+		t.Errorf("Expected the buffered span to be sent on Close, got %v", batches)
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 2}); err == nil {
+		t.Error("Collect after Close succeeded")
+	}
+}
+
+// countingMetrics records collected and dropped spans.
+type countingMetrics struct {
+	NoopMetrics
+	lock      sync.Mutex
+	collected int
+	dropped   int
+}
+
+func (cm *countingMetrics) SpansCollected(count int) {
+	cm.lock.Lock()
+	cm.collected += count
+	cm.lock.Unlock()
+}
+
+func (cm *countingMetrics) SpansDropped(reason DropReason, count int) {
+	cm.lock.Lock()
+	cm.dropped += count
+	cm.lock.Unlock()
+}
+
+func (cm *countingMetrics) counts() (int, int) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return cm.collected, cm.dropped
+}
+
+func TestHTTPCollectorCountsSpansWhenSent(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	accepting := newRecordingServer(t, false)
+	defer accepting.Close()
+	for _, test := range []struct {
+		url                string
+		collected, dropped int
+	}{
+		{accepting.URL, 2, 0},
+		{failing.URL, 0, 2},
+	} {
+		metrics := &countingMetrics{}
+		tracer := NewTracerWithOptions("service", WithMetrics(metrics), WithEndpoint("127.0.0.1", 0))
+		collector := newTestHTTPCollector(t, test.url, 10, 0)
+		collector.config.Metrics = metrics
+		tracer.collector = collector
+
+		tracer.NewSpan("first").Collect()
+		tracer.NewSpan("second").Collect()
+		if collected, dropped := metrics.counts(); collected != 0 || dropped != 0 {
+			t.Errorf("Buffered spans counted as %d collected and %d dropped", collected, dropped)
+		}
+		collector.Close()
+		if collected, dropped := metrics.counts(); collected != test.collected || dropped != test.dropped {
+			t.Errorf("Expected %d collected and %d dropped spans, got %d and %d", test.collected, test.dropped,
+				collected, dropped)
+		}
+	}
+}
+
+// A span tagged after it was collected must not race with the collector
+// encoding it on its own goroutine, run with -race.
+func TestHTTPCollectorSpanTaggedAfterCollect(t *testing.T) {
+	server := newRecordingServer(t, false)
+	defer server.Close()
+	collector := newTestHTTPCollector(t, server.URL, 1, 100)
+	tracer := NewTracerWithOptions("service", WithCollector(collector), WithEndpoint("127.0.0.1", 0))
+
+	span := tracer.NewSpan("request")
+	span.ServerReceiveAndCollect()
+	// keep tagging until the first batch was encoded and received
+	for deadline := time.Now().Add(5 * time.Second); len(server.received()) == 0 && time.Now().Before(deadline); {
+		span.Tag("key", "value")
+		span.Annotate("event")
+		time.Sleep(time.Millisecond)
+	}
+	span.ServerSendAndCollect()
+	collector.Close()
+	if received := server.received(); len(received) != 2 {
+		t.Errorf("Server received batches %v, expected two single span batches", received)
+	}
+}
@@ -0,0 +1,302 @@
+package zipkin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/siesta"
+	"github.com/yanzay/log"
+)
+
+// SpanSink receives the spans decoded by a KafkaIngester.
+type SpanSink interface {
+	WriteSpans(spans []*zipkincore.Span) error
+}
+
+type SpanSinkFunc func(spans []*zipkincore.Span) error
+
+func (f SpanSinkFunc) WriteSpans(spans []*zipkincore.Span) error {
+	return f(spans)
+}
+
+// CollectorSink passes ingested spans on to a collector, e.g. to forward a
+// topic to an HTTP endpoint.
+type CollectorSink struct {
+	Collector Collector
+}
+
+func (cs CollectorSink) WriteSpans(spans []*zipkincore.Span) error {
+	for _, span := range spans {
+		if err := cs.Collector.Collect(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageSource is the part of siesta.Connector a KafkaIngester uses, so
+// tests can consume from an in-memory source such as zipkintest.MessageSource.
+type MessageSource interface {
+	GetOffset(group string, topic string, partition int32) (int64, error)
+	GetAvailableOffset(topic string, partition int32, offsetTime int64) (int64, error)
+	Consume(topic string, partition int32, offset int64) ([]*siesta.MessageAndMetadata, error)
+	CommitOffset(group string, topic string, partition int32, offset int64) error
+}
+
+type KafkaIngesterConfig struct {
+	Group      string
+	Topic      string
+	Partitions []int32
+	// PollInterval is the pause after a fetch returned no messages.
+	PollInterval time.Duration
+	// RetryBackoff is the pause before retrying a failed fetch, sink write or commit.
+	RetryBackoff time.Duration
+	// MaxSinkRetries bounds the retries of a batch the sink keeps rejecting,
+	// after which the partition stops, see KafkaIngester.Err.
+	MaxSinkRetries int
+}
+
+func NewKafkaIngesterConfig(group string) *KafkaIngesterConfig {
+	return &KafkaIngesterConfig{
+		Group:          group,
+		Topic:          DefaultTopic(),
+		Partitions:     []int32{0},
+		PollInterval:   time.Second,
+		RetryBackoff:   time.Second,
+		MaxSinkRetries: 10,
+	}
+}
+
+// KafkaIngester consumes span messages from the partitions of a topic,
+// decodes them with DecodeSpans and writes the spans of each fetched batch to
+// a SpanSink. Offsets are committed only after the sink accepted the batch, so
+// spans are delivered at least once. A failing sink is retried MaxSinkRetries
+// times; then the partition stops consuming without committing the batch and
+// the error is reported by Err and Close. Messages which cannot be decoded are
+// logged and skipped. Consumption resumes at the group's committed offsets, or
+// the earliest available offset if there are none.
+type KafkaIngester struct {
+	source MessageSource
+	sink   SpanSink
+	config *KafkaIngesterConfig
+
+	lock sync.Mutex
+	err  error
+
+	close     chan struct{}
+	closed    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func NewKafkaIngester(source MessageSource, sink SpanSink, config *KafkaIngesterConfig) (*KafkaIngester, error) {
+	if config.Group == "" {
+		return nil, errors.New("Kafka ingester consumer group is required")
+	}
+	if config.Topic == "" {
+		return nil, errors.New("Kafka ingester topic is required")
+	}
+	if len(config.Partitions) == 0 {
+		return nil, errors.New("Kafka ingester needs at least one partition")
+	}
+	if config.PollInterval <= 0 || config.RetryBackoff <= 0 {
+		return nil, errors.New("Kafka ingester poll interval and retry backoff must be positive")
+	}
+	if config.MaxSinkRetries < 0 {
+		return nil, errors.New("Kafka ingester max sink retries must not be negative")
+	}
+	return &KafkaIngester{
+		source: source,
+		sink:   sink,
+		config: config,
+		close:  make(chan struct{}),
+	}, nil
+}
+
+// Start consumes every partition in its own goroutine until Close is called.
+func (ki *KafkaIngester) Start() {
+	for _, partition := range ki.config.Partitions {
+		ki.closed.Add(1)
+		go ki.consumeLoop(partition)
+	}
+}
+
+// Close stops consuming and waits for the batches in flight to be committed.
+// It returns the error which stopped a partition, if any. Later calls only
+// return that error.
+func (ki *KafkaIngester) Close() error {
+	ki.closeOnce.Do(func() {
+		close(ki.close)
+		ki.closed.Wait()
+	})
+	return ki.Err()
+}
+
+// Err returns the error of the first batch the sink rejected MaxSinkRetries
+// times, nil while all partitions are consumed.
+func (ki *KafkaIngester) Err() error {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	return ki.err
+}
+
+func (ki *KafkaIngester) consumeLoop(partition int32) {
+	defer ki.closed.Done()
+	var offset int64
+	for {
+		var err error
+		if offset, err = ki.startOffset(partition); err == nil {
+			break
+		}
+		log.Warningf("[Zipkin] Unable to get offset of %s/%d: %s", ki.config.Topic, partition, err)
+		if !ki.sleep(ki.config.RetryBackoff) {
+			return
+		}
+	}
+	log.Infof("[Zipkin] Ingesting spans from %s/%d at offset %d", ki.config.Topic, partition, offset)
+
+	for {
+		select {
+		case <-ki.close:
+			return
+		default:
+		}
+
+		messages, err := ki.source.Consume(ki.config.Topic, partition, offset)
+		if err != nil {
+			log.Warningf("[Zipkin] Unable to consume %s/%d at offset %d: %s", ki.config.Topic, partition, offset, err)
+			if !ki.sleep(ki.config.RetryBackoff) {
+				return
+			}
+			continue
+		}
+		if len(messages) == 0 {
+			if !ki.sleep(ki.config.PollInterval) {
+				return
+			}
+			continue
+		}
+
+		next, ok := ki.process(partition, offset, messages)
+		if !ok {
+			return
+		}
+		offset = next
+	}
+}
+
+// process writes the spans of the fetched messages to the sink and commits
+// the offset following them. It returns false if closed before succeeding or
+// if the sink failed for good.
+func (ki *KafkaIngester) process(partition int32, offset int64, messages []*siesta.MessageAndMetadata) (int64, bool) {
+	var spans []*zipkincore.Span
+	next := offset
+	for _, message := range messages {
+		if message.Offset < offset {
+			// a compressed message set may start before the requested offset
+			continue
+		}
+		next = message.Offset + 1
+		decoded, err := DecodeSpans(message.Value)
+		if err != nil {
+			log.Warningf("[Zipkin] Skipping undecodable message at %s/%d offset %d: %s", ki.config.Topic,
+				partition, message.Offset, err)
+			continue
+		}
+		spans = append(spans, decoded...)
+	}
+
+	if len(spans) > 0 {
+		for retries := 0; ; retries++ {
+			err := ki.sink.WriteSpans(spans)
+			if err == nil {
+				break
+			}
+			if retries >= ki.config.MaxSinkRetries {
+				log.Warningf("[Zipkin] Span sink failed %d times, stopping ingestion of %s/%d at offset %d: %s",
+					retries+1, ki.config.Topic, partition, offset, err)
+				ki.lock.Lock()
+				if ki.err == nil {
+					ki.err = fmt.Errorf("Span sink failed on %s/%d at offset %d: %s", ki.config.Topic, partition,
+						offset, err)
+				}
+				ki.lock.Unlock()
+				return offset, false
+			}
+			log.Warningf("[Zipkin] Span sink failed, retrying %d spans: %s", len(spans), err)
+			if !ki.sleep(ki.config.RetryBackoff) {
+				return next, false
+			}
+		}
+	}
+	for {
+		err := ki.source.CommitOffset(ki.config.Group, ki.config.Topic, partition, next)
+		if err == nil {
+			return next, true
+		}
+		log.Warningf("[Zipkin] Unable to commit offset %d of %s/%d: %s", next, ki.config.Topic, partition, err)
+		if !ki.sleep(ki.config.RetryBackoff) {
+			return next, false
+		}
+	}
+}
+
+func (ki *KafkaIngester) startOffset(partition int32) (int64, error) {
+	offset, err := ki.source.GetOffset(ki.config.Group, ki.config.Topic, partition)
+	if err == nil && offset >= 0 {
+		return offset, nil
+	}
+	if err != nil {
+		log.Debugf("[Zipkin] No committed offset for group %s on %s/%d: %s", ki.config.Group, ki.config.Topic,
+			partition, err)
+	}
+	return ki.source.GetAvailableOffset(ki.config.Topic, partition, siesta.EarliestTime)
+}
+
+// sleep waits for the duration and returns false if closed meanwhile.
+func (ki *KafkaIngester) sleep(duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-ki.close:
+		return false
+	}
+}
+
+// DecodeSpans decodes a span message as written by the collectors of this
+// package: a binary or compact Thrift span or list of spans, or a JSON span
+// or list of spans, optionally compressed with a Compressor.
+func DecodeSpans(payload []byte) ([]*zipkincore.Span, error) {
+	payload, err := Decompress(payload)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimLeft(payload, " \t\r\n")
+	if len(trimmed) == 0 {
+		return nil, errors.New("Empty span message")
+	}
+	switch trimmed[0] {
+	case '[':
+		return DeserializeSpanListJSON(trimmed)
+	case '{':
+		span, err := DeserializeSpanJSON(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return []*zipkincore.Span{span}, nil
+	}
+	if thrift.TType(payload[0]&0x0f) == thrift.STRUCT {
+		// the low nibble of binary and compact list headers is the struct
+		// type, while span field headers start with the i64 trace id
+		return DeserializeSpanList(payload)
+	}
+	span, err := DeserializeSpan(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []*zipkincore.Span{span}, nil
+}
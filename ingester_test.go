@@ -0,0 +1,123 @@
+package zipkin_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/go-zipkin/zipkintest"
+)
+
+const ingesterGroup = "ingester-test"
+
+func newTestIngester(t *testing.T, source *zipkintest.MessageSource, sink zipkin.SpanSink) *zipkin.KafkaIngester {
+	config := zipkin.NewKafkaIngesterConfig(ingesterGroup)
+	config.PollInterval = time.Millisecond
+	config.RetryBackoff = time.Millisecond
+	config.MaxSinkRetries = 2
+	ingester, err := zipkin.NewKafkaIngester(source, sink, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ingester
+}
+
+func appendSpans(t *testing.T, source *zipkintest.MessageSource, encoder zipkin.SpanEncoder, spans ...*zipkincore.Span) {
+	payload, err := encoder.EncodeSpans(spans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.Append(zipkin.DefaultTopic(), 0, payload)
+}
+
+func waitForCommit(t *testing.T, source *zipkintest.MessageSource, expected int64) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if offset, ok := source.Committed(ingesterGroup, zipkin.DefaultTopic(), 0); ok && offset == expected {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Offset %d was not committed", expected)
+}
+
+func TestKafkaIngesterDeliversAndCommits(t *testing.T) {
+	source := zipkintest.NewMessageSource()
+	appendSpans(t, source, zipkin.ThriftEncoder{}, &zipkincore.Span{ID: 1}, &zipkincore.Span{ID: 2})
+	source.Append(zipkin.DefaultTopic(), 0, []byte("garbage"))
+	appendSpans(t, source, zipkin.JSONEncoder{}, &zipkincore.Span{ID: 3})
+
+	var lock sync.Mutex
+	var ids []int64
+	ingester := newTestIngester(t, source, zipkin.SpanSinkFunc(func(spans []*zipkincore.Span) error {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, span := range spans {
+			ids = append(ids, span.ID)
+		}
+		return nil
+	}))
+	ingester.Start()
+	waitForCommit(t, source, 3)
+	if err := ingester.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("Expected spans 1 to 3 skipping the undecodable message, got %v", ids)
+	}
+}
+
+func TestKafkaIngesterStopsOnPermanentSinkFailure(t *testing.T) {
+	source := zipkintest.NewMessageSource()
+	appendSpans(t, source, zipkin.ThriftEncoder{}, &zipkincore.Span{ID: 1})
+
+	var lock sync.Mutex
+	attempts := 0
+	ingester := newTestIngester(t, source, zipkin.SpanSinkFunc(func(spans []*zipkincore.Span) error {
+		lock.Lock()
+		attempts++
+		lock.Unlock()
+		return errors.New("storage is read-only")
+	}))
+	ingester.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for ingester.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if ingester.Err() == nil {
+		t.Fatal("Permanent sink failure was not reported")
+	}
+	if err := ingester.Close(); err == nil {
+		t.Error("Close did not report the sink failure")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if attempts != 3 {
+		t.Errorf("Expected the first attempt and 2 retries, got %d attempts", attempts)
+	}
+	if offset, ok := source.Committed(ingesterGroup, zipkin.DefaultTopic(), 0); ok {
+		t.Errorf("Offset %d of the rejected batch was committed", offset)
+	}
+}
+
+func TestKafkaIngesterCloseTwice(t *testing.T) {
+	source := zipkintest.NewMessageSource()
+	appendSpans(t, source, zipkin.ThriftEncoder{}, &zipkincore.Span{ID: 1})
+	ingester := newTestIngester(t, source, zipkin.SpanSinkFunc(func(spans []*zipkincore.Span) error {
+		return nil
+	}))
+	ingester.Start()
+	waitForCommit(t, source, 1)
+	if err := ingester.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ingester.Close(); err != nil {
+		t.Errorf("Second Close returned %s", err)
+	}
+}
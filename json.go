@@ -0,0 +1,362 @@
+package zipkin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// JSON model of the Zipkin v1 span format as accepted by POST /api/v1/spans.
+
+type jsonEndpoint struct {
+	ServiceName string `json:"serviceName"`
+	Ipv4        string `json:"ipv4,omitempty"`
+	Port        uint16 `json:"port,omitempty"`
+}
+
+type jsonAnnotation struct {
+	Timestamp int64         `json:"timestamp"`
+	Value     string        `json:"value"`
+	Endpoint  *jsonEndpoint `json:"endpoint,omitempty"`
+}
+
+type jsonBinaryAnnotation struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Type     string          `json:"type,omitempty"`
+	Endpoint *jsonEndpoint   `json:"endpoint,omitempty"`
+}
+
+type jsonSpan struct {
+	TraceID           string                  `json:"traceId"`
+	Name              string                  `json:"name"`
+	ID                string                  `json:"id"`
+	ParentID          string                  `json:"parentId,omitempty"`
+	Timestamp         *int64                  `json:"timestamp,omitempty"`
+	Duration          *int64                  `json:"duration,omitempty"`
+	Debug             bool                    `json:"debug,omitempty"`
+	Annotations       []*jsonAnnotation       `json:"annotations"`
+	BinaryAnnotations []*jsonBinaryAnnotation `json:"binaryAnnotations"`
+}
+
+func SerializeSpanJSON(s *zipkincore.Span) ([]byte, error) {
+	js, err := toJSONSpan(s)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(js)
+}
+
+func SerializeSpanListJSON(spans []*zipkincore.Span) ([]byte, error) {
+	jsonSpans := make([]*jsonSpan, 0, len(spans))
+	for _, s := range spans {
+		js, err := toJSONSpan(s)
+		if err != nil {
+			return nil, err
+		}
+		jsonSpans = append(jsonSpans, js)
+	}
+	return json.Marshal(jsonSpans)
+}
+
+// DeserializeSpanJSON decodes a Zipkin v1 JSON span. Spans have 64-bit ids,
+// so 128-bit trace ids are truncated to their lower 64 bits.
+func DeserializeSpanJSON(data []byte) (*zipkincore.Span, error) {
+	js := &jsonSpan{}
+	if err := json.Unmarshal(data, js); err != nil {
+		return nil, err
+	}
+	return fromJSONSpan(js)
+}
+
+func DeserializeSpanListJSON(data []byte) ([]*zipkincore.Span, error) {
+	var jsonSpans []*jsonSpan
+	if err := json.Unmarshal(data, &jsonSpans); err != nil {
+		return nil, err
+	}
+	spans := make([]*zipkincore.Span, 0, len(jsonSpans))
+	for _, js := range jsonSpans {
+		s, err := fromJSONSpan(js)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, s)
+	}
+	return spans, nil
+}
+
+func toJSONSpan(s *zipkincore.Span) (*jsonSpan, error) {
+	if s == nil {
+		return nil, errors.New("Unable to serialize nil span")
+	}
+	js := &jsonSpan{
+		TraceID:           formatID(s.TraceID),
+		Name:              s.Name,
+		ID:                formatID(s.ID),
+		Timestamp:         s.Timestamp,
+		Duration:          s.Duration,
+		Debug:             s.Debug,
+		Annotations:       make([]*jsonAnnotation, 0, len(s.Annotations)),
+		BinaryAnnotations: make([]*jsonBinaryAnnotation, 0, len(s.BinaryAnnotations)),
+	}
+	if s.ParentID != nil {
+		js.ParentID = formatID(*s.ParentID)
+	}
+	for _, a := range s.Annotations {
+		js.Annotations = append(js.Annotations, &jsonAnnotation{
+			Timestamp: a.Timestamp,
+			Value:     a.Value,
+			Endpoint:  toJSONEndpoint(a.Host),
+		})
+	}
+	for _, ba := range s.BinaryAnnotations {
+		value, err := binaryAnnotationValueJSON(ba)
+		if err != nil {
+			return nil, err
+		}
+		jba := &jsonBinaryAnnotation{
+			Key:      ba.Key,
+			Value:    value,
+			Endpoint: toJSONEndpoint(ba.Host),
+		}
+		if ba.AnnotationType != zipkincore.AnnotationType_STRING {
+			jba.Type = ba.AnnotationType.String()
+		}
+		js.BinaryAnnotations = append(js.BinaryAnnotations, jba)
+	}
+	return js, nil
+}
+
+func fromJSONSpan(js *jsonSpan) (*zipkincore.Span, error) {
+	traceID, err := parseID(js.TraceID)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid traceId: %s", err)
+	}
+	id, err := parseID(js.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid id: %s", err)
+	}
+	s := &zipkincore.Span{
+		TraceID:           traceID,
+		Name:              js.Name,
+		ID:                id,
+		Timestamp:         js.Timestamp,
+		Duration:          js.Duration,
+		Debug:             js.Debug,
+		Annotations:       make([]*zipkincore.Annotation, 0, len(js.Annotations)),
+		BinaryAnnotations: make([]*zipkincore.BinaryAnnotation, 0, len(js.BinaryAnnotations)),
+	}
+	if js.ParentID != "" {
+		parentID, err := parseID(js.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parentId: %s", err)
+		}
+		s.ParentID = &parentID
+	}
+	for _, ja := range js.Annotations {
+		host, err := fromJSONEndpoint(ja.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		s.Annotations = append(s.Annotations, &zipkincore.Annotation{
+			Timestamp: ja.Timestamp,
+			Value:     ja.Value,
+			Host:      host,
+		})
+	}
+	for _, jba := range js.BinaryAnnotations {
+		ba, err := fromJSONBinaryAnnotation(jba)
+		if err != nil {
+			return nil, err
+		}
+		s.BinaryAnnotations = append(s.BinaryAnnotations, ba)
+	}
+	return s, nil
+}
+
+func toJSONEndpoint(e *zipkincore.Endpoint) *jsonEndpoint {
+	if e == nil {
+		return nil
+	}
+	je := &jsonEndpoint{ServiceName: e.ServiceName, Port: uint16(e.Port)}
+	if e.Ipv4 != 0 {
+		je.Ipv4 = formatIPv4(e.Ipv4)
+	}
+	return je
+}
+
+func fromJSONEndpoint(je *jsonEndpoint) (*zipkincore.Endpoint, error) {
+	if je == nil {
+		return nil, nil
+	}
+	e := &zipkincore.Endpoint{ServiceName: je.ServiceName, Port: int16(je.Port)}
+	if je.Ipv4 != "" {
+		ip, err := parseIPv4(je.Ipv4)
+		if err != nil {
+			return nil, err
+		}
+		e.Ipv4 = ip
+	}
+	return e, nil
+}
+
+func binaryAnnotationValueJSON(ba *zipkincore.BinaryAnnotation) (json.RawMessage, error) {
+	v := ba.Value
+	var value interface{}
+	switch ba.AnnotationType {
+	case zipkincore.AnnotationType_BOOL:
+		if len(v) != 1 {
+			return nil, fmt.Errorf("Invalid BOOL value for binary annotation %s", ba.Key)
+		}
+		value = v[0] != 0
+	case zipkincore.AnnotationType_BYTES:
+		value = base64.StdEncoding.EncodeToString(v)
+	case zipkincore.AnnotationType_I16:
+		if len(v) != 2 {
+			return nil, fmt.Errorf("Invalid I16 value for binary annotation %s", ba.Key)
+		}
+		value = int16(binary.BigEndian.Uint16(v))
+	case zipkincore.AnnotationType_I32:
+		if len(v) != 4 {
+			return nil, fmt.Errorf("Invalid I32 value for binary annotation %s", ba.Key)
+		}
+		value = int32(binary.BigEndian.Uint32(v))
+	case zipkincore.AnnotationType_I64:
+		if len(v) != 8 {
+			return nil, fmt.Errorf("Invalid I64 value for binary annotation %s", ba.Key)
+		}
+		value = int64(binary.BigEndian.Uint64(v))
+	case zipkincore.AnnotationType_DOUBLE:
+		if len(v) != 8 {
+			return nil, fmt.Errorf("Invalid DOUBLE value for binary annotation %s", ba.Key)
+		}
+		value = math.Float64frombits(binary.BigEndian.Uint64(v))
+	case zipkincore.AnnotationType_STRING:
+		value = string(v)
+	default:
+		return nil, fmt.Errorf("Unknown type %d of binary annotation %s", ba.AnnotationType, ba.Key)
+	}
+	return json.Marshal(value)
+}
+
+func fromJSONBinaryAnnotation(jba *jsonBinaryAnnotation) (*zipkincore.BinaryAnnotation, error) {
+	host, err := fromJSONEndpoint(jba.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ba := &zipkincore.BinaryAnnotation{Key: jba.Key, Host: host}
+
+	raw := bytes.TrimSpace(jba.Value)
+	if jba.Type == "" {
+		// v1 JSON omits the type for strings and booleans
+		if len(raw) > 0 && raw[0] == '"' {
+			jba.Type = "STRING"
+		} else {
+			jba.Type = "BOOL"
+		}
+	}
+	ba.AnnotationType, err = zipkincore.AnnotationTypeFromString(jba.Type)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid type %s of binary annotation %s", jba.Type, jba.Key)
+	}
+
+	buf := new(bytes.Buffer)
+	switch ba.AnnotationType {
+	case zipkincore.AnnotationType_BOOL:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, fmt.Errorf("Invalid BOOL value for binary annotation %s", jba.Key)
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case zipkincore.AnnotationType_BYTES:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("Invalid BYTES value for binary annotation %s", jba.Key)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid BYTES value for binary annotation %s", jba.Key)
+		}
+		buf.Write(decoded)
+	case zipkincore.AnnotationType_I16, zipkincore.AnnotationType_I32, zipkincore.AnnotationType_I64:
+		n, err := parseJSONInt(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value for binary annotation %s", jba.Type, jba.Key)
+		}
+		switch ba.AnnotationType {
+		case zipkincore.AnnotationType_I16:
+			binary.Write(buf, binary.BigEndian, int16(n))
+		case zipkincore.AnnotationType_I32:
+			binary.Write(buf, binary.BigEndian, int32(n))
+		default:
+			binary.Write(buf, binary.BigEndian, n)
+		}
+	case zipkincore.AnnotationType_DOUBLE:
+		var f float64
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("Invalid DOUBLE value for binary annotation %s", jba.Key)
+		}
+		binary.Write(buf, binary.BigEndian, f)
+	case zipkincore.AnnotationType_STRING:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("Invalid STRING value for binary annotation %s", jba.Key)
+		}
+		buf.WriteString(s)
+	}
+	ba.Value = buf.Bytes()
+	return ba, nil
+}
+
+// parseJSONInt accepts both numbers and quoted numbers, as 64-bit values
+// are often quoted to survive JavaScript consumers.
+func parseJSONInt(raw []byte) (int64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func formatID(id int64) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+func parseID(id string) (int64, error) {
+	if len(id) == 0 || len(id) > 32 {
+		return 0, fmt.Errorf("%q is not a 64 or 128 bit hex id", id)
+	}
+	// keep the lower 64 bits of 128-bit trace ids
+	if len(id) > 16 {
+		id = id[len(id)-16:]
+	}
+	v, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v), nil
+}
+
+func formatIPv4(ip int32) string {
+	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)).String()
+}
+
+func parseIPv4(ip string) (int32, error) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return 0, fmt.Errorf("%q is not a valid ipv4 address", ip)
+	}
+	return int32(binary.BigEndian.Uint32(parsed)), nil
+}
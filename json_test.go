@@ -0,0 +1,111 @@
+package zipkin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+func jsonTestSpan() *zipkincore.Span {
+	parentID := int64(0x0102030405060708)
+	timestamp, duration := int64(1500000000000000), int64(150)
+	host := &zipkincore.Endpoint{ServiceName: "service", Ipv4: 10<<24 | 1, Port: 8080}
+	span := &zipkincore.Span{
+		TraceID:   -2,
+		ID:        0x0a0b0c0d,
+		ParentID:  &parentID,
+		Name:      "get",
+		Timestamp: &timestamp,
+		Duration:  &duration,
+		Debug:     true,
+		Annotations: []*zipkincore.Annotation{
+			{Timestamp: timestamp, Value: zipkincore.SERVER_RECV, Host: host},
+			{Timestamp: timestamp + duration, Value: zipkincore.SERVER_SEND, Host: host},
+		},
+	}
+	for _, value := range []interface{}{true, []byte{0, 1, 2}, int16(-16), int32(32), int64(-64), 6.4, "string"} {
+		key := reflect.TypeOf(value).String()
+		span.BinaryAnnotations = append(span.BinaryAnnotations, NewBinaryAnnotation(key, value, host))
+	}
+	return span
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	span := jsonTestSpan()
+	data, err := SerializeSpanJSON(span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DeserializeSpanJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, span) {
+		t.Errorf("Decoded span %v differs from %v", decoded, span)
+	}
+
+	data, err = SerializeSpanListJSON([]*zipkincore.Span{span, span})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans, err := DeserializeSpanListJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 || !reflect.DeepEqual(spans[1], span) {
+		t.Errorf("Decoded span list %v differs", spans)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	span := jsonTestSpan()
+	span.Annotations = span.Annotations[:1]
+	span.BinaryAnnotations = []*zipkincore.BinaryAnnotation{
+		span.BinaryAnnotations[0], span.BinaryAnnotations[4], span.BinaryAnnotations[6]}
+	data, err := SerializeSpanJSON(span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := `{"serviceName":"service","ipv4":"10.0.0.1","port":8080}`
+	expected := `{"traceId":"fffffffffffffffe","name":"get","id":"000000000a0b0c0d","parentId":"0102030405060708",` +
+		`"timestamp":1500000000000000,"duration":150,"debug":true,` +
+		`"annotations":[{"timestamp":1500000000000000,"value":"sr","endpoint":` + endpoint + `}],` +
+		`"binaryAnnotations":[{"key":"bool","value":true,"type":"BOOL","endpoint":` + endpoint + `},` +
+		`{"key":"int64","value":-64,"type":"I64","endpoint":` + endpoint + `},` +
+		`{"key":"string","value":"string","endpoint":` + endpoint + `}]}`
+	if string(data) != expected {
+		t.Errorf("Encoded\n%s\nexpected\n%s", data, expected)
+	}
+}
+
+func TestJSONDecodesUntypedAndQuotedValues(t *testing.T) {
+	span, err := DeserializeSpanJSON([]byte(`{"traceId":"1","id":"2","name":"get","annotations":[],
+		"binaryAnnotations":[{"key":"s","value":"text"},{"key":"b","value":false},
+		{"key":"i","value":"9007199254740993","type":"I64"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*zipkincore.BinaryAnnotation{
+		NewBinaryAnnotation("s", "text", nil),
+		NewBinaryAnnotation("b", false, nil),
+		NewBinaryAnnotation("i", int64(9007199254740993), nil),
+	}
+	if !reflect.DeepEqual(span.BinaryAnnotations, expected) {
+		t.Errorf("Decoded binary annotations %v, expected %v", span.BinaryAnnotations, expected)
+	}
+}
+
+func TestJSONTruncates128BitTraceIDs(t *testing.T) {
+	span, err := DeserializeSpanJSON([]byte(
+		`{"traceId":"463ac35c9f6413ad48485a3953bb6124","id":"48485a3953bb6124","name":"get"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span.TraceID != 0x48485a3953bb6124 {
+		t.Errorf("Decoded trace id %x, expected the lower 64 bits 48485a3953bb6124", span.TraceID)
+	}
+	if _, err := DeserializeSpanJSON([]byte(`{"traceId":"` + string(make([]byte, 33)) + `","id":"1"}`)); err == nil {
+		t.Error("Decoded a trace id longer than 128 bits")
+	}
+}
@@ -1,17 +1,249 @@
 package zipkin
 
 import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
 	"github.com/elodina/siesta-producer"
 	"github.com/yanzay/log"
 )
 
+// RecordProducer sends records to Kafka, e.g. *producer.KafkaProducer.
+type RecordProducer interface {
+	Send(record *producer.ProducerRecord) <-chan *producer.RecordMetadata
+}
+
 type KafkaCollector struct {
-	producer *producer.KafkaProducer
-	topic string
+	producer RecordProducer
+	topic    string
+	encoder  SpanEncoder
+	// ackTimeout > 0 makes Collect wait for Kafka to acknowledge the span
+	ackTimeout time.Duration
+	metrics    Metrics
+	compressor Compressor
+	threshold  int
+	keyFunc    PartitionKeyFunc
+
+	// batchSize > 1 groups spans into span list records, see SetBatching
+	batchSize     int
+	batchInterval time.Duration
+	lock          sync.Mutex
+	batches       map[string][]*zipkincore.Span // by record key
+	flushTimer    *time.Timer
+	sending       int        // full batches sent in the background
+	sent          *sync.Cond // signalled when sending drops to zero
+}
+
+// PartitionKeyFunc returns the Kafka record key of a span, which the producer
+// hashes to pick the partition. A nil key leaves the choice to the producer.
+type PartitionKeyFunc func(span *zipkincore.Span) []byte
+
+// TraceIDPartitionKey keys records by the hex trace id, so that all spans of
+// a trace land on the same partition.
+func TraceIDPartitionKey(span *zipkincore.Span) []byte {
+	return []byte(formatID(span.TraceID))
+}
+
+func NewKafkaCollector(producer RecordProducer, topic string, encoder SpanEncoder) *KafkaCollector {
+	kc := &KafkaCollector{producer: producer, topic: topic, encoder: encoder, metrics: NoopMetrics{}}
+	kc.sent = sync.NewCond(&kc.lock)
+	return kc
+}
+
+func (kc *KafkaCollector) Collect(span *zipkincore.Span) error {
+	var key []byte
+	if kc.keyFunc != nil {
+		key = kc.keyFunc(span)
+	}
+	if kc.batchSize > 1 {
+		kc.buffer(key, span)
+		return nil
+	}
+	bytes, err := kc.encoder.EncodeSpan(span)
+	if err != nil {
+		return err
+	}
+	return kc.send(key, bytes, 1)
+}
+
+// Flush sends the spans buffered by SetBatching and waits for full batches
+// sent in the background. Call it before closing the producer.
+func (kc *KafkaCollector) Flush() error {
+	kc.lock.Lock()
+	batches := kc.batches
+	kc.batches = nil
+	if kc.flushTimer != nil {
+		kc.flushTimer.Stop()
+		kc.flushTimer = nil
+	}
+	kc.lock.Unlock()
+
+	var flushErr error
+	for key, spans := range batches {
+		if err := kc.sendBatch(recordKey(key), spans); err != nil && flushErr == nil {
+			flushErr = err
+		}
+	}
+	kc.lock.Lock()
+	for kc.sending > 0 {
+		kc.sent.Wait()
+	}
+	kc.lock.Unlock()
+	return flushErr
+}
+
+// buffer adds the span to the batch of its record key, sending the batch in
+// the background once it is full.
+func (kc *KafkaCollector) buffer(key []byte, span *zipkincore.Span) {
+	kc.lock.Lock()
+	if kc.batches == nil {
+		kc.batches = make(map[string][]*zipkincore.Span)
+		if kc.batchInterval > 0 {
+			kc.flushTimer = time.AfterFunc(kc.batchInterval, func() {
+				if err := kc.Flush(); err != nil {
+					log.Warningf("[Zipkin] Unable to send spans to Kafka topic %s: %s", kc.topic, err)
+				}
+			})
+		}
+	}
+	batch := append(kc.batches[string(key)], span)
+	full := len(batch) >= kc.batchSize
+	if full {
+		delete(kc.batches, string(key))
+		kc.sending++
+	} else {
+		kc.batches[string(key)] = batch
+	}
+	kc.lock.Unlock()
+
+	if full {
+		go func() {
+			if err := kc.sendBatch(key, batch); err != nil {
+				log.Warningf("[Zipkin] Unable to send spans to Kafka topic %s: %s", kc.topic, err)
+			}
+			kc.lock.Lock()
+			if kc.sending--; kc.sending == 0 {
+				kc.sent.Broadcast()
+			}
+			kc.lock.Unlock()
+		}()
+	}
+}
+
+// recordKey turns a batch key back into a record key, "" being no key.
+func recordKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// sendBatch sends the spans as one span list record, reporting them as
+// dropped if that fails.
+func (kc *KafkaCollector) sendBatch(key []byte, spans []*zipkincore.Span) error {
+	bytes, err := kc.encoder.EncodeSpans(spans)
+	if err == nil {
+		err = kc.send(key, bytes, len(spans))
+	}
+	if err != nil {
+		kc.metrics.SpansDropped(dropReason(err), len(spans))
+	}
+	return err
 }
 
-func (kc *KafkaCollector) Collect(bytes []byte) {
+func (kc *KafkaCollector) send(key []byte, bytes []byte, spans int) error {
+	bytes, _, err := compress(kc.compressor, kc.threshold, bytes)
+	if err != nil {
+		return err
+	}
 	log.Debugf("[Zipkin] Collecting bytes: %v", bytes)
-	kc.producer.Send(&producer.ProducerRecord{Topic: kc.topic, Value: bytes})
+	record := &producer.ProducerRecord{Topic: kc.topic, Value: bytes}
+	if key != nil {
+		record.Key = key
+	}
+	metadata := kc.producer.Send(record)
 	log.Debugf("[Zipkin] Bytes collected")
+	if kc.ackTimeout <= 0 {
+		kc.metrics.BytesSent(len(bytes))
+		kc.metrics.SpansCollected(spans)
+		return nil
+	}
+	timer := acquireTimer(kc.ackTimeout)
+	defer releaseTimer(timer)
+	select {
+	case m, ok := <-metadata:
+		if !ok || m == nil {
+			return errors.New("Kafka producer closed before acknowledging span")
+		}
+		if m.Error == nil {
+			kc.metrics.BytesSent(len(bytes))
+			kc.metrics.SpansCollected(spans)
+		}
+		return m.Error
+	case <-timer.C:
+		return errors.New("Timed out waiting for Kafka to acknowledge span")
+	}
+}
+
+// SetBatching sends up to size spans with the same record key as one span
+// list record, after at most interval. Compressing batches saves far more
+// than compressing single spans, which rarely reach a useful size. Collect
+// then only buffers the span; spans of failed batches are logged and
+// reported to Metrics as dropped, also when an ack timeout is set. A size
+// below 2 disables batching.
+func (kc *KafkaCollector) SetBatching(size int, interval time.Duration) {
+	kc.batchSize = size
+	kc.batchInterval = interval
+}
+
+// ackTimers keeps the timers of acknowledged Collect calls for reuse.
+var ackTimers sync.Pool
+
+func acquireTimer(timeout time.Duration) *time.Timer {
+	if timer, ok := ackTimers.Get().(*time.Timer); ok {
+		timer.Reset(timeout)
+		return timer
+	}
+	return time.NewTimer(timeout)
+}
+
+func releaseTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		// drain a fired timer, Reset must not see a stale tick
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	ackTimers.Put(timer)
+}
+
+// SetAckTimeout makes Collect wait up to timeout for the span to be
+// acknowledged by Kafka and report failures, e.g. to a SpoolingCollector.
+// Zero, the default, sends spans without waiting.
+func (kc *KafkaCollector) SetAckTimeout(timeout time.Duration) {
+	kc.ackTimeout = timeout
+}
+
+// SetCompression compresses record payloads of at least threshold bytes,
+// combine it with SetBatching for payloads worth compressing. Kafka records
+// carry no content encoding, consumers detect compressed payloads with
+// Decompress.
+func (kc *KafkaCollector) SetCompression(compressor Compressor, threshold int) {
+	kc.compressor = compressor
+	kc.threshold = threshold
+}
+
+// SetPartitionKey keys each record with keyFunc, e.g. TraceIDPartitionKey.
+// The producer must be created with a byte key serializer, as DefaultProducer is.
+func (kc *KafkaCollector) SetPartitionKey(keyFunc PartitionKeyFunc) {
+	kc.keyFunc = keyFunc
+}
+
+// SetMetrics reports the spans and bytes handed to the producer, or
+// acknowledged by Kafka when an ack timeout is set.
+func (kc *KafkaCollector) SetMetrics(metrics Metrics) {
+	kc.metrics = metrics
 }
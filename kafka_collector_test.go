@@ -0,0 +1,135 @@
+package zipkin
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/siesta-producer"
+)
+
+// fakeProducer records the records sent and acknowledges them after delay.
+type fakeProducer struct {
+	lock    sync.Mutex
+	records []*producer.ProducerRecord
+	delay   time.Duration
+}
+
+func (fp *fakeProducer) Send(record *producer.ProducerRecord) <-chan *producer.RecordMetadata {
+	time.Sleep(fp.delay)
+	fp.lock.Lock()
+	fp.records = append(fp.records, record)
+	fp.lock.Unlock()
+	metadata := make(chan *producer.RecordMetadata, 1)
+	metadata <- &producer.RecordMetadata{Topic: record.Topic}
+	return metadata
+}
+
+func (fp *fakeProducer) sent() []*producer.ProducerRecord {
+	fp.lock.Lock()
+	defer fp.lock.Unlock()
+	return append([]*producer.ProducerRecord(nil), fp.records...)
+}
+
+// recordSpans decodes the spans of a record.
+func recordSpans(t *testing.T, record *producer.ProducerRecord) []*zipkincore.Span {
+	spans, err := DecodeSpans(record.Value.([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func TestKafkaCollectorBatchesWithoutKey(t *testing.T) {
+	fake := &fakeProducer{}
+	collector := NewKafkaCollector(fake, "zipkin", ThriftEncoder{})
+	collector.SetBatching(10, 10*time.Millisecond)
+
+	for i := int64(1); i <= 3; i++ {
+		if err := collector.Collect(&zipkincore.Span{TraceID: i, ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return len(fake.sent()) == 1 })
+
+	record := fake.sent()[0]
+	if record.Key != nil {
+		t.Errorf("Batch flushed by the timer has key %v, expected none", record.Key)
+	}
+	if spans := recordSpans(t, record); len(spans) != 3 {
+		t.Errorf("Batch has %d spans, expected 3", len(spans))
+	}
+}
+
+func TestKafkaCollectorFlushWaitsForFullBatches(t *testing.T) {
+	fake := &fakeProducer{delay: 50 * time.Millisecond}
+	collector := NewKafkaCollector(fake, "zipkin", ThriftEncoder{})
+	collector.SetBatching(2, 0)
+
+	for i := int64(1); i <= 3; i++ {
+		collector.Collect(&zipkincore.Span{TraceID: i, ID: i})
+	}
+	if err := collector.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if records := fake.sent(); len(records) != 2 {
+		t.Errorf("Flush returned after %d records, expected the full and the partial batch", len(records))
+	}
+}
+
+func TestTraceIDPartitionKey(t *testing.T) {
+	first := TraceIDPartitionKey(&zipkincore.Span{TraceID: 1, ID: 1})
+	sibling := TraceIDPartitionKey(&zipkincore.Span{TraceID: 1, ID: 2})
+	other := TraceIDPartitionKey(&zipkincore.Span{TraceID: 2, ID: 3})
+	if string(first) != string(sibling) {
+		t.Errorf("Spans of one trace have keys %q and %q", first, sibling)
+	}
+	if string(first) == string(other) {
+		t.Errorf("Spans of different traces share key %q", first)
+	}
+}
+
+func TestKafkaCollectorKeysRecords(t *testing.T) {
+	fake := &fakeProducer{}
+	collector := NewKafkaCollector(fake, "zipkin", ThriftEncoder{})
+	collector.SetPartitionKey(TraceIDPartitionKey)
+
+	collector.Collect(&zipkincore.Span{TraceID: 1, ID: 1})
+	records := fake.sent()
+	if len(records) != 1 || string(records[0].Key.([]byte)) != formatID(1) {
+		t.Errorf("Expected one record keyed %s, got %v", formatID(1), records)
+	}
+}
+
+func TestKafkaCollectorGroupsBatchesByKey(t *testing.T) {
+	fake := &fakeProducer{}
+	collector := NewKafkaCollector(fake, "zipkin", ThriftEncoder{})
+	collector.SetPartitionKey(TraceIDPartitionKey)
+	collector.SetBatching(10, 0)
+
+	for id, traceID := range []int64{1, 2, 1, 1} {
+		collector.Collect(&zipkincore.Span{TraceID: traceID, ID: int64(id)})
+	}
+	if err := collector.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := fake.sent()
+	if len(records) != 2 {
+		t.Errorf("Expected one record per trace, got %d", len(records))
+	}
+	spansByKey := make(map[string]int)
+	for _, record := range records {
+		key := string(record.Key.([]byte))
+		for _, span := range recordSpans(t, record) {
+			if formatID(span.TraceID) != key {
+				t.Errorf("Span of trace %x in batch keyed %s", span.TraceID, key)
+			}
+		}
+		spansByKey[key] += len(recordSpans(t, record))
+	}
+	if len(spansByKey) != 2 || spansByKey[formatID(1)] != 3 || spansByKey[formatID(2)] != 1 {
+		t.Errorf("Expected batches of 3 and 1 spans for traces 1 and 2, got %v", spansByKey)
+	}
+}
@@ -0,0 +1,23 @@
+package zipkin
+
+import "github.com/elodina/go-zipkin/gen-go/zipkincore"
+
+// LegacyCollector is the Collector interface of earlier versions of this
+// library, receiving each span serialized with binary Thrift.
+type LegacyCollector interface {
+	Collect(bytes []byte)
+}
+
+// LegacyCollectorAdapter makes a LegacyCollector usable as Collector.
+type LegacyCollectorAdapter struct {
+	Collector LegacyCollector
+}
+
+func (a LegacyCollectorAdapter) Collect(span *zipkincore.Span) error {
+	bytes, err := SerializeSpan(span)
+	if err != nil {
+		return err
+	}
+	a.Collector.Collect(bytes)
+	return nil
+}
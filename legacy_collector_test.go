@@ -0,0 +1,37 @@
+package zipkin
+
+import (
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+type byteCollector struct {
+	payloads [][]byte
+}
+
+func (c *byteCollector) Collect(bytes []byte) {
+	c.payloads = append(c.payloads, bytes)
+}
+
+func TestLegacyCollectorAdapter(t *testing.T) {
+	legacy := &byteCollector{}
+	tracer := NewTracerWithOptions("service", WithCollector(LegacyCollectorAdapter{Collector: legacy}),
+		WithEndpoint("127.0.0.1", 80))
+	span := tracer.NewSpan("span")
+	span.ClientSend()
+	if err := span.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	if len(legacy.payloads) != 1 {
+		t.Fatalf("Expected 1 payload, got %d", len(legacy.payloads))
+	}
+	decoded, err := DeserializeSpan(legacy.payloads[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "span" || len(decoded.Annotations) != 1 ||
+		decoded.Annotations[0].Value != zipkincore.CLIENT_SEND {
+		t.Errorf("Unexpected span %v", decoded)
+	}
+}
@@ -0,0 +1,57 @@
+package zipkin
+
+import "time"
+
+// DropReason tells why spans were dropped instead of being sent.
+type DropReason string
+
+const (
+	DropReasonQueueFull      DropReason = "queue_full"
+	DropReasonTooLarge       DropReason = "too_large"
+	DropReasonCircuitOpen    DropReason = "circuit_open"
+	DropReasonCollectorError DropReason = "collector_error"
+)
+
+// Metrics receives counters and gauges about the tracer and collectors, see
+// WithMetrics. The tracer reports spans started, sampled and finished, the
+// latency of each Collect call and the spans Collect rejects; collectors
+// report the spans and bytes they send, their queue depth and the spans they
+// drop in the background. A span is counted as collected once it has been
+// sent, not when a batching collector buffers it. QueueDepth is a single
+// gauge: collectors sharing one Metrics overwrite each other's depth, so give
+// each collector its own Metrics to tell their queues apart.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	SpanStarted()
+	SpanSampled()
+	SpanFinished()
+	SpansCollected(count int)
+	SpansDropped(reason DropReason, count int)
+	BytesSent(bytes int)
+	QueueDepth(depth int)
+	CollectLatency(latency time.Duration)
+}
+
+// NoopMetrics discards all metrics.
+type NoopMetrics struct{}
+
+func (NoopMetrics) SpanStarted()                              {}
+func (NoopMetrics) SpanSampled()                              {}
+func (NoopMetrics) SpanFinished()                             {}
+func (NoopMetrics) SpansCollected(count int)                  {}
+func (NoopMetrics) SpansDropped(reason DropReason, count int) {}
+func (NoopMetrics) BytesSent(bytes int)                       {}
+func (NoopMetrics) QueueDepth(depth int)                      {}
+func (NoopMetrics) CollectLatency(latency time.Duration)      {}
+
+func dropReason(err error) DropReason {
+	switch err {
+	case ErrQueueFull:
+		return DropReasonQueueFull
+	case ErrSpanTooLarge:
+		return DropReasonTooLarge
+	case ErrCircuitOpen:
+		return DropReasonCircuitOpen
+	}
+	return DropReasonCollectorError
+}
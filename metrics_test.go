@@ -0,0 +1,108 @@
+package zipkin
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reportMetrics(metrics Metrics) {
+	metrics.SpanStarted()
+	metrics.SpanStarted()
+	metrics.SpanSampled()
+	metrics.SpanFinished()
+	metrics.SpansCollected(3)
+	metrics.SpansDropped(DropReasonQueueFull, 2)
+	metrics.SpansDropped(DropReasonTooLarge, 1)
+	metrics.SpansDropped(DropReasonQueueFull, 1)
+	metrics.BytesSent(100)
+	metrics.QueueDepth(7)
+	metrics.QueueDepth(4)
+	metrics.CollectLatency(1500 * time.Microsecond)
+	metrics.CollectLatency(500 * time.Microsecond)
+}
+
+func TestPrometheusMetricsExposition(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	reportMetrics(metrics)
+
+	expected := `# HELP zipkin_spans_started_total Spans started, sampled or not.
+# TYPE zipkin_spans_started_total counter
+zipkin_spans_started_total 2
+# HELP zipkin_spans_sampled_total Spans started which are sampled.
+# TYPE zipkin_spans_sampled_total counter
+zipkin_spans_sampled_total 1
+# HELP zipkin_spans_finished_total Sampled spans passed to the collector.
+# TYPE zipkin_spans_finished_total counter
+zipkin_spans_finished_total 1
+# HELP zipkin_spans_collected_total Spans sent by the collectors.
+# TYPE zipkin_spans_collected_total counter
+zipkin_spans_collected_total 3
+# HELP zipkin_spans_dropped_total Spans dropped instead of being sent.
+# TYPE zipkin_spans_dropped_total counter
+zipkin_spans_dropped_total{reason="queue_full"} 3
+zipkin_spans_dropped_total{reason="too_large"} 1
+# HELP zipkin_bytes_sent_total Bytes sent by the collectors.
+# TYPE zipkin_bytes_sent_total counter
+zipkin_bytes_sent_total 100
+# HELP zipkin_queue_depth Spans queued in the collector.
+# TYPE zipkin_queue_depth gauge
+zipkin_queue_depth 4
+# HELP zipkin_collect_latency_seconds Latency of passing a span to the collector.
+# TYPE zipkin_collect_latency_seconds summary
+zipkin_collect_latency_seconds_sum 0.002
+zipkin_collect_latency_seconds_count 2
+`
+	var buf bytes.Buffer
+	n, err := metrics.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if recorder.Body.String() != expected {
+		t.Errorf("Unexpected response body:\n%s", recorder.Body.String())
+	}
+}
+
+func TestExpvarMetricsMap(t *testing.T) {
+	metrics := NewExpvarMetrics("zipkin_test_metrics")
+	reportMetrics(metrics)
+
+	var actual map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get("zipkin_test_metrics").String()), &actual); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"spans_started":   2.0,
+		"spans_sampled":   1.0,
+		"spans_finished":  1.0,
+		"spans_collected": 3.0,
+		"spans_dropped": map[string]interface{}{
+			"queue_full": 3.0,
+			"too_large":  1.0,
+		},
+		"bytes_sent":         100.0,
+		"queue_depth":        4.0,
+		"collect_count":      2.0,
+		"collect_latency_us": 2000.0,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected expvar map %v, expected %v", actual, expected)
+	}
+}
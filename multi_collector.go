@@ -0,0 +1,187 @@
+package zipkin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+var errCloseTimeout = errors.New("Timed out sending the queued spans")
+
+// CollectorError is the error a single destination of a MultiCollector returned.
+type CollectorError struct {
+	Index     int
+	Collector Collector
+	Err       error
+}
+
+func (ce *CollectorError) Error() string {
+	return fmt.Sprintf("collector %d (%T): %s", ce.Index, ce.Collector, ce.Err)
+}
+
+// MultiCollectorError aggregates the errors of the destinations which failed.
+type MultiCollectorError []*CollectorError
+
+func (mce MultiCollectorError) Error() string {
+	messages := make([]string, len(mce))
+	for i, err := range mce {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d of the collectors failed: %s", len(mce), strings.Join(messages, "; "))
+}
+
+type MultiCollectorConfig struct {
+	// QueueSize bounds the spans waiting for each destination.
+	QueueSize int
+	// CloseTimeout bounds how long Close waits for the destinations to take
+	// their queued spans and close.
+	CloseTimeout time.Duration
+	// Metrics receives the spans a destination failed to collect.
+	Metrics Metrics
+}
+
+func NewMultiCollectorConfig() *MultiCollectorConfig {
+	return &MultiCollectorConfig{
+		QueueSize:    1000,
+		CloseTimeout: 5 * time.Second,
+		Metrics:      NoopMetrics{},
+	}
+}
+
+// MultiCollector sends every span to all of its collectors. Each destination
+// has its own queue drained by its own goroutine, so a slow or hanging
+// destination neither delays Collect nor the other destinations. Collect
+// only fails for the destinations whose queue is full; errors of the
+// destinations themselves are logged and reported to Metrics as dropped spans.
+type MultiCollector struct {
+	config       *MultiCollectorConfig
+	destinations []*destination
+
+	lock    sync.RWMutex
+	closing bool
+}
+
+type destination struct {
+	collector Collector
+	queue     chan *zipkincore.Span
+	done      chan struct{}
+}
+
+// NewMultiCollector creates a MultiCollector with the default configuration.
+func NewMultiCollector(collectors ...Collector) *MultiCollector {
+	mc, _ := NewMultiCollectorWithConfig(NewMultiCollectorConfig(), collectors...)
+	return mc
+}
+
+func NewMultiCollectorWithConfig(config *MultiCollectorConfig, collectors ...Collector) (*MultiCollector, error) {
+	if config.QueueSize <= 0 {
+		return nil, errors.New("Multi collector queue size must be positive")
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+	mc := &MultiCollector{config: config}
+	for i, collector := range collectors {
+		d := &destination{
+			collector: collector,
+			queue:     make(chan *zipkincore.Span, config.QueueSize),
+			done:      make(chan struct{}),
+		}
+		mc.destinations = append(mc.destinations, d)
+		go mc.send(i, d)
+	}
+	return mc, nil
+}
+
+// Collect queues the span for every destination. Destinations with a full
+// queue miss the span and are reported in a MultiCollectorError.
+func (mc *MultiCollector) Collect(span *zipkincore.Span) error {
+	mc.lock.RLock()
+	defer mc.lock.RUnlock()
+	if mc.closing {
+		return errors.New("Multi collector is closed")
+	}
+	var failed MultiCollectorError
+	for i, d := range mc.destinations {
+		select {
+		case d.queue <- span:
+		default:
+			failed = append(failed, &CollectorError{Index: i, Collector: d.collector, Err: ErrQueueFull})
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Close waits up to CloseTimeout for every destination to collect its queued
+// spans and then closes the collectors which support closing. Destinations
+// which did not finish in time are reported in a MultiCollectorError.
+func (mc *MultiCollector) Close() error {
+	mc.lock.Lock()
+	if mc.closing {
+		mc.lock.Unlock()
+		return nil
+	}
+	mc.closing = true
+	for _, d := range mc.destinations {
+		close(d.queue)
+	}
+	mc.lock.Unlock()
+
+	results := make([]chan error, len(mc.destinations))
+	for i, d := range mc.destinations {
+		results[i] = make(chan error, 1)
+		go func(d *destination, result chan error) {
+			<-d.done
+			if closer, ok := d.collector.(interface {
+				Close() error
+			}); ok {
+				result <- closer.Close()
+				return
+			}
+			result <- nil
+		}(d, results[i])
+	}
+
+	expired := make(chan struct{})
+	timer := time.AfterFunc(mc.config.CloseTimeout, func() { close(expired) })
+	defer timer.Stop()
+	var failed MultiCollectorError
+	for i, result := range results {
+		var err error
+		select {
+		case err = <-result:
+		case <-expired:
+			// destinations done meanwhile still count as closed
+			select {
+			case err = <-result:
+			default:
+				err = errCloseTimeout
+			}
+		}
+		if err != nil {
+			failed = append(failed, &CollectorError{Index: i, Collector: mc.destinations[i].collector, Err: err})
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (mc *MultiCollector) send(index int, d *destination) {
+	defer close(d.done)
+	for span := range d.queue {
+		if err := d.collector.Collect(span); err != nil {
+			log.Warningf("[Zipkin] Collector %d (%T) failed to collect span %x: %s", index, d.collector, span.ID, err)
+			mc.config.Metrics.SpansDropped(dropReason(err), 1)
+		}
+	}
+}
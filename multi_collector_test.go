@@ -0,0 +1,77 @@
+package zipkin
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// blockingCollector blocks in Collect until released.
+type blockingCollector struct {
+	release chan struct{}
+}
+
+func (bc *blockingCollector) Collect(span *zipkincore.Span) error {
+	<-bc.release
+	return nil
+}
+
+type countingCollector struct {
+	lock  sync.Mutex
+	spans int
+}
+
+func (cc *countingCollector) Collect(span *zipkincore.Span) error {
+	cc.lock.Lock()
+	cc.spans++
+	cc.lock.Unlock()
+	return nil
+}
+
+func (cc *countingCollector) count() int {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.spans
+}
+
+func TestMultiCollectorHangingDestination(t *testing.T) {
+	hanging := &blockingCollector{release: make(chan struct{})}
+	defer close(hanging.release)
+	counting := &countingCollector{}
+	config := NewMultiCollectorConfig()
+	config.QueueSize = 2
+	config.CloseTimeout = 10 * time.Millisecond
+	collector, err := NewMultiCollectorWithConfig(config, hanging, counting)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the healthy destination takes every span while the hanging one holds
+	// at most one in Collect and two in its queue
+	var lastErr error
+	for i := int64(0); i < 5; i++ {
+		lastErr = collector.Collect(&zipkincore.Span{ID: i})
+		deadline := time.Now().Add(time.Second)
+		for counting.count() <= int(i) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	failed, ok := lastErr.(MultiCollectorError)
+	if !ok || len(failed) != 1 || failed[0].Index != 0 || failed[0].Err != ErrQueueFull {
+		t.Errorf("Expected the hanging destination's queue to be full, got %v", lastErr)
+	}
+	if counting.count() != 5 {
+		t.Errorf("Expected the healthy destination to receive 5 spans, got %d", counting.count())
+	}
+
+	err = collector.Close()
+	failed, ok = err.(MultiCollectorError)
+	if !ok || len(failed) != 1 || failed[0].Index != 0 || failed[0].Err != errCloseTimeout {
+		t.Errorf("Expected Close to time out on the hanging destination, got %v", err)
+	}
+	if err := collector.Collect(&zipkincore.Span{}); err == nil {
+		t.Error("Collect after Close succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+package zipkin
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/yanzay/log"
+)
+
+type TracerOption func(*Tracer)
+
+// IDGenerator returns trace and span ids.
+type IDGenerator func() int64
+
+// Clock returns the current time used for annotation timestamps.
+type Clock func() time.Time
+
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+type defaultLogger struct{}
+
+func (defaultLogger) Debugf(format string, args ...interface{}) {
+	log.Debugf(format, args...)
+}
+
+func (defaultLogger) Infof(format string, args ...interface{}) {
+	log.Infof(format, args...)
+}
+
+func (defaultLogger) Warningf(format string, args ...interface{}) {
+	log.Warningf(format, args...)
+}
+
+func WithCollector(collector Collector) TracerOption {
+	return func(t *Tracer) {
+		t.collector = collector
+	}
+}
+
+func WithSampler(sampler Sampler) TracerOption {
+	return func(t *Tracer) {
+		t.sampler = sampler
+	}
+}
+
+// WithEndpoint sets the ipv4 address and port reported in annotations. An
+// empty address means LocalNetworkIP(), an address which is not a valid ipv4
+// address is replaced with localhost.
+func WithEndpoint(ip string, port int16) TracerOption {
+	return func(t *Tracer) {
+		t.ip = ip
+		t.port = port
+	}
+}
+
+func WithIDGenerator(generator IDGenerator) TracerOption {
+	return func(t *Tracer) {
+		t.idGenerator = generator
+	}
+}
+
+func WithClock(clock Clock) TracerOption {
+	return func(t *Tracer) {
+		t.clock = clock
+	}
+}
+
+func WithLogger(logger Logger) TracerOption {
+	return func(t *Tracer) {
+		t.logger = logger
+	}
+}
+
+// WithPropagators sets the propagators used to inject and extract trace
+// context. For each carrier the first propagator supporting it is used.
+func WithPropagators(propagators ...Propagator) TracerOption {
+	return func(t *Tracer) {
+		t.propagators = propagators
+	}
+}
+
+// WithMetrics reports span counts and collect outcomes to metrics. Collectors
+// take their own Metrics, which may be the same value.
+func WithMetrics(metrics Metrics) TracerOption {
+	return func(t *Tracer) {
+		t.metrics = metrics
+	}
+}
+
+func defaultIDGenerator() int64 {
+	return rand.Int63()
+}
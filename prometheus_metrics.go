@@ -0,0 +1,134 @@
+package zipkin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PrometheusMetrics counts metrics in memory and serves them over HTTP in
+// the Prometheus text exposition format:
+//
+//	http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	spansStarted   int64
+	spansSampled   int64
+	spansFinished  int64
+	spansCollected int64
+	bytesSent      int64
+	queueDepth     int64
+	collectCount   int64
+	collectNanos   int64
+
+	lock    sync.Mutex
+	dropped map[DropReason]int64
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{dropped: make(map[DropReason]int64)}
+}
+
+func (pm *PrometheusMetrics) SpanStarted() {
+	atomic.AddInt64(&pm.spansStarted, 1)
+}
+
+func (pm *PrometheusMetrics) SpanSampled() {
+	atomic.AddInt64(&pm.spansSampled, 1)
+}
+
+func (pm *PrometheusMetrics) SpanFinished() {
+	atomic.AddInt64(&pm.spansFinished, 1)
+}
+
+func (pm *PrometheusMetrics) SpansCollected(count int) {
+	atomic.AddInt64(&pm.spansCollected, int64(count))
+}
+
+func (pm *PrometheusMetrics) SpansDropped(reason DropReason, count int) {
+	pm.lock.Lock()
+	pm.dropped[reason] += int64(count)
+	pm.lock.Unlock()
+}
+
+func (pm *PrometheusMetrics) BytesSent(bytes int) {
+	atomic.AddInt64(&pm.bytesSent, int64(bytes))
+}
+
+func (pm *PrometheusMetrics) QueueDepth(depth int) {
+	atomic.StoreInt64(&pm.queueDepth, int64(depth))
+}
+
+func (pm *PrometheusMetrics) CollectLatency(latency time.Duration) {
+	atomic.AddInt64(&pm.collectCount, 1)
+	atomic.AddInt64(&pm.collectNanos, int64(latency))
+}
+
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	pm.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (pm *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	out := &countingWriter{w: w}
+	writeMetric(out, "zipkin_spans_started_total", "counter", "Spans started, sampled or not.",
+		atomic.LoadInt64(&pm.spansStarted))
+	writeMetric(out, "zipkin_spans_sampled_total", "counter", "Spans started which are sampled.",
+		atomic.LoadInt64(&pm.spansSampled))
+	writeMetric(out, "zipkin_spans_finished_total", "counter", "Sampled spans passed to the collector.",
+		atomic.LoadInt64(&pm.spansFinished))
+	writeMetric(out, "zipkin_spans_collected_total", "counter", "Spans sent by the collectors.",
+		atomic.LoadInt64(&pm.spansCollected))
+
+	pm.lock.Lock()
+	reasons := make([]string, 0, len(pm.dropped))
+	dropped := make(map[string]int64, len(pm.dropped))
+	for reason, count := range pm.dropped {
+		reasons = append(reasons, string(reason))
+		dropped[string(reason)] = count
+	}
+	pm.lock.Unlock()
+	sort.Strings(reasons)
+	fmt.Fprintf(out, "# HELP zipkin_spans_dropped_total Spans dropped instead of being sent.\n")
+	fmt.Fprintf(out, "# TYPE zipkin_spans_dropped_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(out, "zipkin_spans_dropped_total{reason=%q} %d\n", reason, dropped[reason])
+	}
+
+	writeMetric(out, "zipkin_bytes_sent_total", "counter", "Bytes sent by the collectors.",
+		atomic.LoadInt64(&pm.bytesSent))
+	writeMetric(out, "zipkin_queue_depth", "gauge", "Spans queued in the collector.",
+		atomic.LoadInt64(&pm.queueDepth))
+
+	fmt.Fprintf(out, "# HELP zipkin_collect_latency_seconds Latency of passing a span to the collector.\n")
+	fmt.Fprintf(out, "# TYPE zipkin_collect_latency_seconds summary\n")
+	fmt.Fprintf(out, "zipkin_collect_latency_seconds_sum %g\n",
+		time.Duration(atomic.LoadInt64(&pm.collectNanos)).Seconds())
+	fmt.Fprintf(out, "zipkin_collect_latency_seconds_count %d\n", atomic.LoadInt64(&pm.collectCount))
+	return out.n, out.err
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// countingWriter remembers the bytes written and the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
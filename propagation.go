@@ -0,0 +1,172 @@
+package zipkin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/elodina/go-avro"
+)
+
+var (
+	ErrUnsupportedCarrier  = errors.New("No propagator supports the given carrier")
+	ErrSpanContextNotFound = errors.New("Carrier holds no trace context")
+)
+
+// SpanContext is the part of a span propagated across process boundaries.
+type SpanContext struct {
+	TraceID  int64
+	SpanID   int64
+	ParentID *int64
+	// Sampled is nil when the upstream left the sampling decision to us.
+	Sampled *bool
+	Debug   bool
+}
+
+// Propagator writes and reads SpanContexts to and from carriers such as
+// HTTP headers or Avro records. Both methods return ErrUnsupportedCarrier for
+// carriers of unknown type.
+type Propagator interface {
+	Inject(context SpanContext, carrier interface{}) error
+	Extract(carrier interface{}) (*SpanContext, error)
+}
+
+const (
+	b3TraceID      = "X-B3-TraceId"
+	b3SpanID       = "X-B3-SpanId"
+	b3ParentSpanID = "X-B3-ParentSpanId"
+	b3Sampled      = "X-B3-Sampled"
+	b3Flags        = "X-B3-Flags"
+)
+
+// B3Propagator propagates trace context in B3 headers. Carriers are
+// http.Header and map[string]string.
+type B3Propagator struct{}
+
+func (B3Propagator) Inject(context SpanContext, carrier interface{}) error {
+	var set func(key, value string)
+	switch c := carrier.(type) {
+	case http.Header:
+		set = c.Set
+	case map[string]string:
+		set = func(key, value string) {
+			c[key] = value
+		}
+	default:
+		return ErrUnsupportedCarrier
+	}
+
+	if context.TraceID != 0 || context.SpanID != 0 {
+		set(b3TraceID, formatID(context.TraceID))
+		set(b3SpanID, formatID(context.SpanID))
+		if context.ParentID != nil {
+			set(b3ParentSpanID, formatID(*context.ParentID))
+		}
+	}
+	if context.Debug {
+		set(b3Flags, "1")
+	} else if context.Sampled != nil {
+		if *context.Sampled {
+			set(b3Sampled, "1")
+		} else {
+			set(b3Sampled, "0")
+		}
+	}
+	return nil
+}
+
+func (B3Propagator) Extract(carrier interface{}) (*SpanContext, error) {
+	var get func(key string) string
+	switch c := carrier.(type) {
+	case http.Header:
+		get = c.Get
+	case map[string]string:
+		get = func(key string) string {
+			for k, v := range c {
+				if strings.EqualFold(k, key) {
+					return v
+				}
+			}
+			return ""
+		}
+	default:
+		return nil, ErrUnsupportedCarrier
+	}
+
+	context := &SpanContext{}
+	switch strings.ToLower(get(b3Sampled)) {
+	case "1", "true", "d":
+		sampled := true
+		context.Sampled = &sampled
+	case "0", "false":
+		sampled := false
+		context.Sampled = &sampled
+	}
+	if get(b3Flags) == "1" {
+		sampled := true
+		context.Sampled = &sampled
+		context.Debug = true
+	}
+
+	traceID, spanID := get(b3TraceID), get(b3SpanID)
+	if traceID == "" || spanID == "" {
+		if context.Sampled != nil {
+			// a bare sampling decision is propagated as well
+			return context, nil
+		}
+		return nil, ErrSpanContextNotFound
+	}
+	var err error
+	if context.TraceID, err = parseID(traceID); err != nil {
+		return nil, err
+	}
+	if context.SpanID, err = parseID(spanID); err != nil {
+		return nil, err
+	}
+	if parentID := get(b3ParentSpanID); parentID != "" {
+		id, err := parseID(parentID)
+		if err != nil {
+			return nil, err
+		}
+		context.ParentID = &id
+	}
+	return context, nil
+}
+
+// AvroPropagator propagates trace context in *avro.GenericRecord carriers
+// with the TraceInfo schema.
+type AvroPropagator struct{}
+
+func (AvroPropagator) Inject(context SpanContext, carrier interface{}) error {
+	record, ok := carrier.(*avro.GenericRecord)
+	if !ok {
+		return ErrUnsupportedCarrier
+	}
+	record.Set("traceId", context.TraceID)
+	record.Set("spanId", context.SpanID)
+	if context.ParentID != nil {
+		record.Set("parentSpanId", *context.ParentID)
+	}
+	record.Set("sampled", context.Sampled != nil && *context.Sampled)
+	return nil
+}
+
+func (AvroPropagator) Extract(carrier interface{}) (*SpanContext, error) {
+	record, ok := carrier.(*avro.GenericRecord)
+	if !ok {
+		return nil, ErrUnsupportedCarrier
+	}
+	traceID, traceOk := record.Get("traceId").(int64)
+	spanID, spanOk := record.Get("spanId").(int64)
+	if !traceOk || !spanOk {
+		return nil, ErrSpanContextNotFound
+	}
+	context := &SpanContext{TraceID: traceID, SpanID: spanID}
+	if parentID, ok := record.Get("parentSpanId").(int64); ok {
+		context.ParentID = &parentID
+	}
+	if sampled, ok := record.Get("sampled").(bool); ok {
+		context.Sampled = &sampled
+	}
+	return context, nil
+}
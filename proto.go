@@ -0,0 +1,344 @@
+package zipkin
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// Proto3Encoder writes spans in the zipkin2 proto3 ListOfSpans format
+// (https://github.com/openzipkin/zipkin-api/blob/master/zipkin.proto).
+// A v1 span carrying both client and server annotations is split into a
+// client span and a shared server span, as the Zipkin v1 converter does.
+type Proto3Encoder struct{}
+
+func (Proto3Encoder) EncodeSpan(span *zipkincore.Span) ([]byte, error) {
+	return SerializeSpanListProto3([]*zipkincore.Span{span})
+}
+
+func (Proto3Encoder) EncodeSpans(spans []*zipkincore.Span) ([]byte, error) {
+	return SerializeSpanListProto3(spans)
+}
+
+func (Proto3Encoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Messaging annotations, which are not part of zipkinCore.thrift shipped here.
+const (
+	MessageSend = "ms"
+	MessageRecv = "mr"
+	MessageAddr = "ma"
+)
+
+const (
+	spanKindUnspecified = 0
+	spanKindClient      = 1
+	spanKindServer      = 2
+	spanKindProducer    = 3
+	spanKindConsumer    = 4
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type v2Endpoint struct {
+	serviceName string
+	ipv4        int32
+	port        int16
+}
+
+type v2Span struct {
+	traceID        int64
+	parentID       *int64
+	id             int64
+	kind           int
+	name           string
+	timestamp      int64
+	duration       int64
+	localEndpoint  *v2Endpoint
+	remoteEndpoint *v2Endpoint
+	annotations    []*zipkincore.Annotation
+	tags           map[string]string
+	debug          bool
+	shared         bool
+}
+
+func SerializeSpanListProto3(spans []*zipkincore.Span) ([]byte, error) {
+	buf := make([]byte, 0, 256*len(spans))
+	for _, s := range spans {
+		if s == nil {
+			return nil, errors.New("Unable to serialize nil span")
+		}
+		converted, err := toV2Spans(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, v2 := range converted {
+			// ListOfSpans: repeated Span spans = 1
+			buf = appendBytesField(buf, 1, marshalV2Span(v2))
+		}
+	}
+	return buf, nil
+}
+
+func toV2Spans(s *zipkincore.Span) ([]*v2Span, error) {
+	var cs, cr, sr, ss, ms, mr *zipkincore.Annotation
+	var others []*zipkincore.Annotation
+	for _, a := range s.Annotations {
+		switch a.Value {
+		case zipkincore.CLIENT_SEND:
+			cs = a
+		case zipkincore.CLIENT_RECV:
+			cr = a
+		case zipkincore.SERVER_RECV:
+			sr = a
+		case zipkincore.SERVER_SEND:
+			ss = a
+		case MessageSend:
+			ms = a
+		case MessageRecv:
+			mr = a
+		default:
+			others = append(others, a)
+		}
+	}
+
+	base := func(kind int, begin, end *zipkincore.Annotation) *v2Span {
+		v2 := &v2Span{
+			traceID:  s.TraceID,
+			parentID: s.ParentID,
+			id:       s.ID,
+			kind:     kind,
+			name:     s.Name,
+			debug:    s.Debug,
+			tags:     make(map[string]string),
+		}
+		if begin != nil {
+			v2.timestamp = begin.Timestamp
+			v2.localEndpoint = toV2Endpoint(begin.Host)
+			if end != nil {
+				v2.duration = end.Timestamp - begin.Timestamp
+			}
+		} else if end != nil {
+			v2.localEndpoint = toV2Endpoint(end.Host)
+		}
+		return v2
+	}
+
+	var spans []*v2Span
+	var client, server *v2Span
+	if cs != nil || cr != nil {
+		client = base(spanKindClient, cs, cr)
+		spans = append(spans, client)
+	}
+	if sr != nil || ss != nil {
+		server = base(spanKindServer, sr, ss)
+		server.shared = client != nil
+		spans = append(spans, server)
+	}
+	if ms != nil {
+		spans = append(spans, base(spanKindProducer, ms, nil))
+	}
+	if mr != nil {
+		spans = append(spans, base(spanKindConsumer, mr, nil))
+	}
+	if len(spans) == 0 {
+		local := base(spanKindUnspecified, nil, nil)
+		if len(others) > 0 {
+			local.localEndpoint = toV2Endpoint(others[0].Host)
+		}
+		spans = append(spans, local)
+	}
+
+	// Explicit span timing wins over the one derived from annotations and
+	// belongs to the first span, i.e. the client side of a shared span.
+	first := spans[0]
+	if s.Timestamp != nil {
+		first.timestamp = *s.Timestamp
+	}
+	if s.Duration != nil {
+		first.duration = *s.Duration
+	}
+	if first.timestamp == 0 && len(others) > 0 {
+		first.timestamp = others[0].Timestamp
+	}
+	first.annotations = others
+
+	for _, ba := range s.BinaryAnnotations {
+		switch ba.Key {
+		case zipkincore.SERVER_ADDR, zipkincore.CLIENT_ADDR, MessageAddr:
+			endpoint := toV2Endpoint(ba.Host)
+			if ba.Key == zipkincore.SERVER_ADDR && client != nil {
+				client.remoteEndpoint = endpoint
+			} else if ba.Key == zipkincore.CLIENT_ADDR && server != nil {
+				server.remoteEndpoint = endpoint
+			} else {
+				first.remoteEndpoint = endpoint
+			}
+			continue
+		}
+		value, err := binaryAnnotationValueString(ba)
+		if err != nil {
+			return nil, err
+		}
+		first.tags[ba.Key] = value
+		if first.localEndpoint == nil {
+			first.localEndpoint = toV2Endpoint(ba.Host)
+		}
+	}
+	return spans, nil
+}
+
+func toV2Endpoint(e *zipkincore.Endpoint) *v2Endpoint {
+	if e == nil {
+		return nil
+	}
+	return &v2Endpoint{serviceName: e.ServiceName, ipv4: e.Ipv4, port: e.Port}
+}
+
+// binaryAnnotationValueString renders a typed binary annotation value as
+// a v2 tag value.
+func binaryAnnotationValueString(ba *zipkincore.BinaryAnnotation) (string, error) {
+	v := ba.Value
+	switch ba.AnnotationType {
+	case zipkincore.AnnotationType_STRING:
+		return string(v), nil
+	case zipkincore.AnnotationType_BYTES:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case zipkincore.AnnotationType_BOOL:
+		if len(v) == 1 {
+			return strconv.FormatBool(v[0] != 0), nil
+		}
+	case zipkincore.AnnotationType_I16:
+		if len(v) == 2 {
+			return strconv.FormatInt(int64(int16(binary.BigEndian.Uint16(v))), 10), nil
+		}
+	case zipkincore.AnnotationType_I32:
+		if len(v) == 4 {
+			return strconv.FormatInt(int64(int32(binary.BigEndian.Uint32(v))), 10), nil
+		}
+	case zipkincore.AnnotationType_I64:
+		if len(v) == 8 {
+			return strconv.FormatInt(int64(binary.BigEndian.Uint64(v)), 10), nil
+		}
+	case zipkincore.AnnotationType_DOUBLE:
+		if len(v) == 8 {
+			return strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(v)), 'g', -1, 64), nil
+		}
+	default:
+		return "", fmt.Errorf("Unknown type %d of binary annotation %s", ba.AnnotationType, ba.Key)
+	}
+	return "", fmt.Errorf("Invalid %s value for binary annotation %s", ba.AnnotationType, ba.Key)
+}
+
+func marshalV2Span(s *v2Span) []byte {
+	buf := make([]byte, 0, 128)
+	buf = appendBytesField(buf, 1, idBytes(s.traceID))
+	if s.parentID != nil {
+		buf = appendBytesField(buf, 2, idBytes(*s.parentID))
+	}
+	buf = appendBytesField(buf, 3, idBytes(s.id))
+	if s.kind != spanKindUnspecified {
+		buf = appendVarintField(buf, 4, uint64(s.kind))
+	}
+	if s.name != "" {
+		buf = appendBytesField(buf, 5, []byte(s.name))
+	}
+	if s.timestamp != 0 {
+		buf = appendFixed64Field(buf, 6, uint64(s.timestamp))
+	}
+	if s.duration > 0 {
+		buf = appendVarintField(buf, 7, uint64(s.duration))
+	}
+	if s.localEndpoint != nil {
+		buf = appendBytesField(buf, 8, marshalV2Endpoint(s.localEndpoint))
+	}
+	if s.remoteEndpoint != nil {
+		buf = appendBytesField(buf, 9, marshalV2Endpoint(s.remoteEndpoint))
+	}
+	for _, a := range s.annotations {
+		annotation := appendFixed64Field(nil, 1, uint64(a.Timestamp))
+		annotation = appendBytesField(annotation, 2, []byte(a.Value))
+		buf = appendBytesField(buf, 10, annotation)
+	}
+	// map entries are sorted so the output is deterministic
+	keys := make([]string, 0, len(s.tags))
+	for k := range s.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry := appendBytesField(nil, 1, []byte(k))
+		entry = appendBytesField(entry, 2, []byte(s.tags[k]))
+		buf = appendBytesField(buf, 11, entry)
+	}
+	if s.debug {
+		buf = appendVarintField(buf, 12, 1)
+	}
+	if s.shared {
+		buf = appendVarintField(buf, 13, 1)
+	}
+	return buf
+}
+
+func marshalV2Endpoint(e *v2Endpoint) []byte {
+	var buf []byte
+	if e.serviceName != "" {
+		buf = appendBytesField(buf, 1, []byte(e.serviceName))
+	}
+	if e.ipv4 != 0 {
+		ip := make([]byte, 4)
+		binary.BigEndian.PutUint32(ip, uint32(e.ipv4))
+		buf = appendBytesField(buf, 2, ip)
+	}
+	if e.port != 0 {
+		buf = appendVarintField(buf, 4, uint64(uint16(e.port)))
+	}
+	return buf
+}
+
+func idBytes(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendVarint(buf, uint64(field<<3|wireType))
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = appendTag(buf, field, wireVarint)
+	return appendVarint(buf, v)
+}
+
+func appendFixed64Field(buf []byte, field int, v uint64) []byte {
+	buf = appendTag(buf, field, wireFixed64)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendBytesField(buf []byte, field int, v []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendVarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
@@ -0,0 +1,295 @@
+package zipkin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	frontend = &zipkincore.Endpoint{ServiceName: "frontend", Ipv4: 0x0a000001, Port: 8080}
+	backend  = &zipkincore.Endpoint{ServiceName: "backend", Ipv4: 0x0a000002, Port: 9000}
+)
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
+
+// goldenSpans are the spans encoded in testdata/proto3_<name>.golden.
+var goldenSpans = map[string][]*zipkincore.Span{
+	"shared": {{
+		TraceID:  0x0102030405060708,
+		ParentID: int64Ptr(0x1112131415161718),
+		ID:       0x2122232425262728,
+		Name:     "get /orders",
+		Annotations: []*zipkincore.Annotation{
+			{Timestamp: 1000, Value: zipkincore.CLIENT_SEND, Host: frontend},
+			{Timestamp: 1100, Value: zipkincore.SERVER_RECV, Host: backend},
+			{Timestamp: 1500, Value: "cache miss", Host: backend},
+			{Timestamp: 1900, Value: zipkincore.SERVER_SEND, Host: backend},
+			{Timestamp: 2000, Value: zipkincore.CLIENT_RECV, Host: frontend},
+		},
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			NewBinaryAnnotation(zipkincore.HTTP_PATH, "/orders", backend),
+			NewBinaryAnnotation(zipkincore.HTTP_STATUS_CODE, int16(200), backend),
+			{Key: zipkincore.SERVER_ADDR, Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_BOOL,
+				Host: backend},
+		},
+	}},
+	"local": {{
+		TraceID:   -1,
+		ID:        -2,
+		Name:      "compute",
+		Debug:     true,
+		Timestamp: int64Ptr(5000),
+		Duration:  int64Ptr(250),
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			NewBinaryAnnotation(zipkincore.LOCAL_COMPONENT, "worker", frontend),
+			NewBinaryAnnotation("cached", true, frontend),
+			NewBinaryAnnotation("rows", int64(-42), frontend),
+			NewBinaryAnnotation("ratio", 0.25, frontend),
+			NewBinaryAnnotation("raw", []byte{0xde, 0xad}, frontend),
+		},
+	}},
+	"messaging": {{
+		TraceID: 7,
+		ID:      8,
+		Name:    "orders",
+		Annotations: []*zipkincore.Annotation{
+			{Timestamp: 3000, Value: MessageSend, Host: frontend},
+		},
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			{Key: MessageAddr, Value: []byte{1}, AnnotationType: zipkincore.AnnotationType_BOOL,
+				Host: &zipkincore.Endpoint{ServiceName: "kafka"}},
+		},
+	}, {
+		TraceID:  7,
+		ParentID: int64Ptr(8),
+		ID:       9,
+		Name:     "orders",
+		Annotations: []*zipkincore.Annotation{
+			{Timestamp: 3500, Value: MessageRecv, Host: backend},
+		},
+	}},
+}
+
+type decodedEndpoint struct {
+	ServiceName string
+	IPv4        []byte
+	Port        uint64
+}
+
+type decodedAnnotation struct {
+	Timestamp uint64
+	Value     string
+}
+
+type decodedSpan struct {
+	TraceID, ParentID, ID []byte
+	Kind                  uint64
+	Name                  string
+	Timestamp, Duration   uint64
+	LocalEndpoint         *decodedEndpoint
+	RemoteEndpoint        *decodedEndpoint
+	Annotations           []decodedAnnotation
+	Tags                  map[string]string
+	Debug, Shared         bool
+}
+
+func id(value uint64) []byte {
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(bytes, value)
+	return bytes
+}
+
+var (
+	decodedFrontend = &decodedEndpoint{ServiceName: "frontend", IPv4: []byte{10, 0, 0, 1}, Port: 8080}
+	decodedBackend  = &decodedEndpoint{ServiceName: "backend", IPv4: []byte{10, 0, 0, 2}, Port: 9000}
+)
+
+// decodedGoldenSpans are the zipkin2 spans expected in the golden files.
+var decodedGoldenSpans = map[string][]decodedSpan{
+	"shared": {{
+		TraceID: id(0x0102030405060708), ParentID: id(0x1112131415161718), ID: id(0x2122232425262728),
+		Kind: spanKindClient, Name: "get /orders", Timestamp: 1000, Duration: 1000,
+		LocalEndpoint: decodedFrontend, RemoteEndpoint: decodedBackend,
+		Annotations: []decodedAnnotation{{Timestamp: 1500, Value: "cache miss"}},
+		Tags:        map[string]string{zipkincore.HTTP_PATH: "/orders", zipkincore.HTTP_STATUS_CODE: "200"},
+	}, {
+		TraceID: id(0x0102030405060708), ParentID: id(0x1112131415161718), ID: id(0x2122232425262728),
+		Kind: spanKindServer, Name: "get /orders", Timestamp: 1100, Duration: 800,
+		LocalEndpoint: decodedBackend, Shared: true,
+	}},
+	"local": {{
+		TraceID: id(0xffffffffffffffff), ID: id(0xfffffffffffffffe), Name: "compute", Timestamp: 5000, Duration: 250,
+		LocalEndpoint: decodedFrontend, Debug: true,
+		Tags: map[string]string{zipkincore.LOCAL_COMPONENT: "worker", "cached": "true", "rows": "-42",
+			"ratio": "0.25", "raw": "3q0="},
+	}},
+	"messaging": {{
+		TraceID: id(7), ID: id(8), Kind: spanKindProducer, Name: "orders", Timestamp: 3000,
+		LocalEndpoint: decodedFrontend, RemoteEndpoint: &decodedEndpoint{ServiceName: "kafka"},
+	}, {
+		TraceID: id(7), ParentID: id(8), ID: id(9), Kind: spanKindConsumer, Name: "orders", Timestamp: 3500,
+		LocalEndpoint: decodedBackend,
+	}},
+}
+
+func TestProto3Golden(t *testing.T) {
+	for name, spans := range goldenSpans {
+		path := filepath.Join("testdata", "proto3_"+name+".golden")
+		encoded, err := SerializeSpanListProto3(spans)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if *update {
+			if err := ioutil.WriteFile(path, encoded, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		golden, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, golden) {
+			t.Errorf("%s: encoding differs from %s, run go test -update after checking the change", name, path)
+		}
+
+		decoded := decodeListOfSpans(t, golden)
+		if !reflect.DeepEqual(decoded, decodedGoldenSpans[name]) {
+			t.Errorf("%s: decoded\n%+v\nexpected\n%+v", name, decoded, decodedGoldenSpans[name])
+		}
+	}
+}
+
+// decodeListOfSpans parses zipkin2 ListOfSpans with the reference protobuf
+// wire decoder, failing on fields unknown to zipkin.proto.
+func decodeListOfSpans(t *testing.T, data []byte) []decodedSpan {
+	var spans []decodedSpan
+	forEachField(t, data, func(number protowire.Number, value []byte, varint uint64) {
+		if number != 1 {
+			t.Fatalf("Unexpected ListOfSpans field %d", number)
+		}
+		spans = append(spans, decodeSpan(t, value))
+	})
+	return spans
+}
+
+func decodeSpan(t *testing.T, data []byte) decodedSpan {
+	span := decodedSpan{}
+	forEachField(t, data, func(number protowire.Number, value []byte, varint uint64) {
+		switch number {
+		case 1:
+			span.TraceID = value
+		case 2:
+			span.ParentID = value
+		case 3:
+			span.ID = value
+		case 4:
+			span.Kind = varint
+		case 5:
+			span.Name = string(value)
+		case 6:
+			span.Timestamp = varint
+		case 7:
+			span.Duration = varint
+		case 8:
+			span.LocalEndpoint = decodeEndpoint(t, value)
+		case 9:
+			span.RemoteEndpoint = decodeEndpoint(t, value)
+		case 10:
+			annotation := decodedAnnotation{}
+			forEachField(t, value, func(number protowire.Number, value []byte, varint uint64) {
+				if number == 1 {
+					annotation.Timestamp = varint
+				} else {
+					annotation.Value = string(value)
+				}
+			})
+			span.Annotations = append(span.Annotations, annotation)
+		case 11:
+			var key, tag string
+			forEachField(t, value, func(number protowire.Number, value []byte, varint uint64) {
+				if number == 1 {
+					key = string(value)
+				} else {
+					tag = string(value)
+				}
+			})
+			if span.Tags == nil {
+				span.Tags = make(map[string]string)
+			}
+			span.Tags[key] = tag
+		case 12:
+			span.Debug = varint != 0
+		case 13:
+			span.Shared = varint != 0
+		default:
+			t.Fatalf("Unexpected Span field %d", number)
+		}
+	})
+	return span
+}
+
+func decodeEndpoint(t *testing.T, data []byte) *decodedEndpoint {
+	endpoint := &decodedEndpoint{}
+	forEachField(t, data, func(number protowire.Number, value []byte, varint uint64) {
+		switch number {
+		case 1:
+			endpoint.ServiceName = string(value)
+		case 2:
+			endpoint.IPv4 = value
+		case 4:
+			endpoint.Port = varint
+		default:
+			t.Fatalf("Unexpected Endpoint field %d", number)
+		}
+	})
+	return endpoint
+}
+
+// forEachField calls handle with the payload of length delimited fields or
+// the value of varint and fixed64 fields.
+func forEachField(t *testing.T, data []byte, handle func(number protowire.Number, value []byte, varint uint64)) {
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch wireType {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			handle(number, value, 0)
+			data = data[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			handle(number, nil, value)
+			data = data[n:]
+		case protowire.Fixed64Type:
+			value, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				t.Fatal(protowire.ParseError(n))
+			}
+			handle(number, nil, value)
+			data = data[n:]
+		default:
+			t.Fatalf("Unexpected wire type %d of field %d", wireType, number)
+		}
+	}
+}
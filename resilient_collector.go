@@ -0,0 +1,355 @@
+package zipkin
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+var ErrCircuitOpen = errors.New("Collector circuit breaker is open")
+
+type BreakerState int
+
+const (
+	// BreakerClosed passes spans to the downstream collector.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects spans with ErrCircuitOpen without calling the downstream.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe span through to test the downstream.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type ResilientCollectorConfig struct {
+	// MaxRetries is the number of retries after a failed Collect, zero disables retrying.
+	MaxRetries int
+	// Retries back off exponentially from InitialBackoff up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter shortens each backoff by a random fraction up to Jitter, between 0 and 1.
+	Jitter float64
+	// QueueSize bounds the spans waiting to be retried.
+	QueueSize int
+	// FailureThreshold consecutive failed spans open the circuit breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before the downstream is probed.
+	OpenTimeout time.Duration
+	// OnStateChange, if set, is called on every breaker state transition.
+	OnStateChange func(from, to BreakerState)
+	// Metrics receives the spans dropped after their last retry.
+	Metrics Metrics
+}
+
+func NewResilientCollectorConfig() *ResilientCollectorConfig {
+	return &ResilientCollectorConfig{
+		MaxRetries:       2,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		Jitter:           0.2,
+		QueueSize:        1000,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		Metrics:          NoopMetrics{},
+	}
+}
+
+// ResilientCollector retries failed spans with exponential backoff and stops
+// calling a downstream collector which keeps failing. Collect makes a single
+// attempt; failed spans are queued and retried in the background, so Collect
+// never sleeps. After FailureThreshold consecutive failures the breaker opens
+// and spans are rejected right away with ErrCircuitOpen. OpenTimeout later a
+// timer probes the downstream with the span which opened the breaker, or lets
+// the next span through if there is none: success closes the breaker, failure
+// opens it again. Results of calls started before the last state change are
+// ignored, so a slow call can't close a breaker opened meanwhile.
+type ResilientCollector struct {
+	downstream Collector
+	config     *ResilientCollectorConfig
+
+	lock     sync.Mutex
+	state    BreakerState
+	failures int
+	// generation counts the state transitions
+	generation uint64
+	probing    bool
+	// probeSpan is sent by the probe timer
+	probeSpan *zipkincore.Span
+	probe     *time.Timer
+	closing   bool
+	// transitions not yet reported to OnStateChange
+	transitions [][2]BreakerState
+
+	retries   chan *retry
+	close     chan struct{}
+	closeOnce sync.Once
+	closed    sync.WaitGroup
+}
+
+type retry struct {
+	span    *zipkincore.Span
+	attempt int
+}
+
+func NewResilientCollector(downstream Collector, config *ResilientCollectorConfig) (*ResilientCollector, error) {
+	if config.MaxRetries < 0 {
+		return nil, errors.New("Collector max retries must not be negative")
+	}
+	if config.MaxRetries > 0 && (config.InitialBackoff <= 0 || config.MaxBackoff < config.InitialBackoff) {
+		return nil, errors.New("Collector retry backoff must be positive and not exceed the max backoff")
+	}
+	if config.MaxRetries > 0 && config.QueueSize <= 0 {
+		return nil, errors.New("Collector retry queue size must be positive")
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		return nil, errors.New("Collector retry jitter must be between 0 and 1")
+	}
+	if config.FailureThreshold <= 0 {
+		return nil, errors.New("Collector failure threshold must be positive")
+	}
+	if config.OpenTimeout <= 0 {
+		return nil, errors.New("Collector open timeout must be positive")
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+	rc := &ResilientCollector{
+		downstream: downstream,
+		config:     config,
+		retries:    make(chan *retry, config.QueueSize),
+		close:      make(chan struct{}),
+	}
+	rc.closed.Add(1)
+	go rc.retryLoop()
+	return rc, nil
+}
+
+// Collect sends the span once. A failed span is queued for retrying and
+// Collect succeeds, unless the failure opened the breaker or the retry queue
+// is full.
+func (rc *ResilientCollector) Collect(span *zipkincore.Span) error {
+	generation, probe, err := rc.acquire()
+	if err != nil {
+		return err
+	}
+	err = rc.downstream.Collect(span)
+	if !rc.record(generation, probe, span, err) || probe || rc.config.MaxRetries == 0 {
+		return err
+	}
+	log.Debugf("[Zipkin] Collector failed, retrying in the background: %s", err)
+	select {
+	case rc.retries <- &retry{span: span, attempt: 1}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// State returns the current breaker state.
+func (rc *ResilientCollector) State() BreakerState {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return rc.state
+}
+
+// Close stops retrying and probing and closes the downstream collector if it
+// supports closing. Spans still waiting to be retried are dropped.
+func (rc *ResilientCollector) Close() error {
+	var err error
+	rc.closeOnce.Do(func() {
+		rc.lock.Lock()
+		rc.closing = true
+		if rc.probe != nil && rc.probe.Stop() {
+			rc.closed.Done()
+		}
+		rc.lock.Unlock()
+		close(rc.close)
+		rc.closed.Wait()
+		if dropped := len(rc.retries); dropped > 0 {
+			rc.config.Metrics.SpansDropped(DropReasonCollectorError, dropped)
+		}
+
+		if closer, ok := rc.downstream.(interface {
+			Close() error
+		}); ok {
+			err = closer.Close()
+		}
+	})
+	return err
+}
+
+// acquire decides whether a span may be sent and whether it is the probe of
+// a half-open breaker. It returns the generation the call starts in.
+func (rc *ResilientCollector) acquire() (uint64, bool, error) {
+	rc.lock.Lock()
+	defer rc.unlock()
+	switch rc.state {
+	case BreakerOpen:
+		return 0, false, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if rc.probing {
+			return 0, false, ErrCircuitOpen
+		}
+		rc.probing = true
+		return rc.generation, true, nil
+	}
+	return rc.generation, false, nil
+}
+
+// record updates the breaker with the result of a call started in the given
+// generation and reports whether the breaker is still closed.
+func (rc *ResilientCollector) record(generation uint64, probe bool, span *zipkincore.Span, err error) bool {
+	rc.lock.Lock()
+	defer rc.unlock()
+	if probe {
+		rc.probing = false
+	} else if generation != rc.generation {
+		// the call started before the breaker changed state, its result is stale
+		return rc.state == BreakerClosed
+	}
+	if err == nil {
+		rc.failures = 0
+		if rc.state != BreakerClosed {
+			rc.probeSpan = nil
+			rc.transition(BreakerClosed)
+		}
+		return true
+	}
+
+	rc.failures++
+	if probe || (rc.state == BreakerClosed && rc.failures >= rc.config.FailureThreshold) {
+		log.Warningf("[Zipkin] Collector failed %d times in a row, opening circuit breaker for %s: %s",
+			rc.failures, rc.config.OpenTimeout, err)
+		rc.probeSpan = span
+		rc.transition(BreakerOpen)
+		rc.scheduleProbe()
+	}
+	return rc.state == BreakerClosed
+}
+
+// scheduleProbe starts the timer ending the open state. Must be called with the lock held.
+func (rc *ResilientCollector) scheduleProbe() {
+	if rc.closing {
+		return
+	}
+	rc.closed.Add(1)
+	rc.probe = time.AfterFunc(rc.config.OpenTimeout, func() {
+		defer rc.closed.Done()
+		rc.probeDownstream()
+	})
+}
+
+// probeDownstream half-opens the breaker and sends the span which opened it.
+func (rc *ResilientCollector) probeDownstream() {
+	rc.lock.Lock()
+	if rc.closing || rc.state != BreakerOpen {
+		rc.unlock()
+		return
+	}
+	rc.transition(BreakerHalfOpen)
+	span := rc.probeSpan
+	if span == nil {
+		// the next span collected is the probe
+		rc.unlock()
+		return
+	}
+	rc.probing = true
+	generation := rc.generation
+	rc.unlock()
+
+	rc.record(generation, true, span, rc.downstream.Collect(span))
+}
+
+// transition must be called with the lock held, OnStateChange is called by unlock.
+func (rc *ResilientCollector) transition(state BreakerState) {
+	rc.transitions = append(rc.transitions, [2]BreakerState{rc.state, state})
+	rc.state = state
+	rc.generation++
+}
+
+// unlock releases the lock and reports the transitions made while holding it,
+// so that OnStateChange may call back into the collector.
+func (rc *ResilientCollector) unlock() {
+	transitions := rc.transitions
+	rc.transitions = nil
+	rc.lock.Unlock()
+	if rc.config.OnStateChange != nil {
+		for _, t := range transitions {
+			rc.config.OnStateChange(t[0], t[1])
+		}
+	}
+}
+
+// retryLoop retries queued spans in order, each after its backoff.
+func (rc *ResilientCollector) retryLoop() {
+	defer rc.closed.Done()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		var r *retry
+		select {
+		case r = <-rc.retries:
+		case <-rc.close:
+			return
+		}
+		timer.Reset(rc.jitter(rc.backoff(r.attempt)))
+		select {
+		case <-timer.C:
+		case <-rc.close:
+			timer.Stop()
+			rc.config.Metrics.SpansDropped(DropReasonCollectorError, 1)
+			return
+		}
+
+		generation, probe, err := rc.acquire()
+		if err != nil {
+			rc.config.Metrics.SpansDropped(dropReason(err), 1)
+			continue
+		}
+		err = rc.downstream.Collect(r.span)
+		closed := rc.record(generation, probe, r.span, err)
+		if err == nil {
+			continue
+		}
+		if closed && !probe && r.attempt < rc.config.MaxRetries {
+			r.attempt++
+			select {
+			case rc.retries <- r:
+				continue
+			default:
+			}
+		}
+		log.Warningf("[Zipkin] Collector failed after %d retries, dropping span: %s", r.attempt, err)
+		rc.config.Metrics.SpansDropped(DropReasonCollectorError, 1)
+	}
+}
+
+// backoff returns the pause before the given retry.
+func (rc *ResilientCollector) backoff(attempt int) time.Duration {
+	backoff := rc.config.InitialBackoff
+	for i := 1; i < attempt && backoff < rc.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > rc.config.MaxBackoff {
+		backoff = rc.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (rc *ResilientCollector) jitter(backoff time.Duration) time.Duration {
+	return backoff - time.Duration(rand.Float64()*rc.config.Jitter*float64(backoff))
+}
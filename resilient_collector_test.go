@@ -0,0 +1,126 @@
+package zipkin
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// scriptedCollector fails the first failures calls. Calls for spans listed
+// in block signal entered and return the error sent on their channel.
+type scriptedCollector struct {
+	lock     sync.Mutex
+	failures int
+	calls    int
+	sent     []int64
+	block    map[int64]chan error
+	entered  chan struct{}
+}
+
+func (sc *scriptedCollector) Collect(span *zipkincore.Span) error {
+	sc.lock.Lock()
+	release := sc.block[span.ID]
+	sc.lock.Unlock()
+	if release != nil {
+		sc.entered <- struct{}{}
+		return <-release
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	sc.calls++
+	if sc.calls <= sc.failures {
+		return errors.New("down")
+	}
+	sc.sent = append(sc.sent, span.ID)
+	return nil
+}
+
+func (sc *scriptedCollector) received() []int64 {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return append([]int64(nil), sc.sent...)
+}
+
+func newTestResilientCollector(t *testing.T, downstream Collector, threshold int, openTimeout time.Duration) *ResilientCollector {
+	config := NewResilientCollectorConfig()
+	config.InitialBackoff = 50 * time.Millisecond
+	config.MaxBackoff = 50 * time.Millisecond
+	config.FailureThreshold = threshold
+	config.OpenTimeout = openTimeout
+	collector, err := NewResilientCollector(downstream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResilientCollectorRetriesInBackground(t *testing.T) {
+	downstream := &scriptedCollector{failures: 1}
+	collector := newTestResilientCollector(t, downstream, 5, time.Hour)
+	defer collector.Close()
+
+	start := time.Now()
+	if err := collector.Collect(&zipkincore.Span{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Collect waited %s for the retry", elapsed)
+	}
+	waitFor(t, func() bool { return len(downstream.received()) == 1 })
+}
+
+func TestResilientCollectorProbesOnTimer(t *testing.T) {
+	downstream := &scriptedCollector{failures: 1}
+	collector := newTestResilientCollector(t, downstream, 1, 10*time.Millisecond)
+	defer collector.Close()
+
+	if err := collector.Collect(&zipkincore.Span{ID: 1}); err == nil {
+		t.Fatal("Failure opening the breaker was not reported")
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 2}); err != ErrCircuitOpen {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	// no further span arrives, the timer sends the span which opened the breaker
+	waitFor(t, func() bool { return collector.State() == BreakerClosed })
+	if spans := downstream.received(); len(spans) != 1 || spans[0] != 1 {
+		t.Errorf("Expected the probe to send span 1, got %v", spans)
+	}
+}
+
+func TestResilientCollectorIgnoresStaleSuccess(t *testing.T) {
+	release := make(chan error)
+	downstream := &scriptedCollector{failures: 1, block: map[int64]chan error{1: release},
+		entered: make(chan struct{})}
+	collector := newTestResilientCollector(t, downstream, 1, time.Hour)
+	defer collector.Close()
+
+	done := make(chan struct{})
+	go func() {
+		collector.Collect(&zipkincore.Span{ID: 1})
+		close(done)
+	}()
+	// span 1 is in flight when the breaker opens
+	<-downstream.entered
+	if err := collector.Collect(&zipkincore.Span{ID: 2}); err == nil {
+		t.Fatal("Failure opening the breaker was not reported")
+	}
+	release <- nil
+	<-done
+	if state := collector.State(); state != BreakerOpen {
+		t.Errorf("Success of a call started before the breaker opened closed it, state %s", state)
+	}
+}
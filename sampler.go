@@ -0,0 +1,47 @@
+package zipkin
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Sampler decides whether a new trace with the given id is recorded.
+type Sampler func(traceID int64) bool
+
+func AlwaysSample(traceID int64) bool {
+	return true
+}
+
+func NeverSample(traceID int64) bool {
+	return false
+}
+
+// NewRateSampler samples 1 of every rate traces at random. A rate below 1
+// disables sampling.
+func NewRateSampler(rate int) Sampler {
+	if rate < 1 {
+		return NeverSample
+	}
+	return func(traceID int64) bool {
+		return rand.Intn(rate) == 0
+	}
+}
+
+// NewProbabilitySampler samples the given fraction of traces. The decision is
+// derived from the trace id, so it is the same for every span of a trace.
+func NewProbabilitySampler(probability float64) Sampler {
+	if probability <= 0 {
+		return NeverSample
+	}
+	if probability >= 1 {
+		return AlwaysSample
+	}
+	boundary := uint64(probability * math.MaxInt64)
+	return func(traceID int64) bool {
+		id := uint64(traceID)
+		if traceID < 0 {
+			id = uint64(-(traceID + 1))
+		}
+		return id < boundary
+	}
+}
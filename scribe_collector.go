@@ -0,0 +1,291 @@
+package zipkin
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"github.com/elodina/go-zipkin/gen-go/scribe"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+type ScribeCollectorConfig struct {
+	Addr          string
+	Category      string
+	BatchSize     int
+	BatchInterval time.Duration
+	// QueueSize bounds the spans buffered for sending, Collect fails with
+	// ErrQueueFull beyond it. Zero means ten batches.
+	QueueSize int
+	// RetryBackoff is the pause after a failed or TRY_LATER send before the
+	// re-queued batch is sent again.
+	RetryBackoff time.Duration
+	Timeout      time.Duration
+	// Metrics receives the bytes sent, the batch size and spans lost by failed sends.
+	Metrics Metrics
+}
+
+func NewScribeCollectorConfig(addr string) *ScribeCollectorConfig {
+	return &ScribeCollectorConfig{
+		Addr:          addr,
+		Category:      "zipkin",
+		BatchSize:     100,
+		BatchInterval: time.Second,
+		QueueSize:     1000,
+		RetryBackoff:  time.Second,
+		Timeout:       5 * time.Second,
+		Metrics:       NoopMetrics{},
+	}
+}
+
+// ScribeCollector sends spans to a legacy Zipkin collector as base64 encoded
+// binary Thrift messages through Scribe Log calls over a framed transport.
+// Batches are sent in the background once BatchSize spans are buffered or
+// BatchInterval passes. A batch which fails or is answered with TRY_LATER is
+// put back in front of the queue and sent again after RetryBackoff; spans are
+// only lost once the queue is full or when Close fails to send them. A broken
+// connection is dropped and re-established on the next send.
+type ScribeCollector struct {
+	config *ScribeCollectorConfig
+
+	lock    sync.Mutex
+	batch   []*scribe.LogEntry
+	closing bool
+
+	// sendLock guards the connection, which is used by one Log call at a time
+	sendLock  sync.Mutex
+	transport thrift.TTransport
+	client    *scribe.ScribeClient
+
+	// full wakes the send loop once a batch is complete
+	full      chan struct{}
+	close     chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	closed    sync.WaitGroup
+}
+
+func NewScribeCollector(config *ScribeCollectorConfig) (*ScribeCollector, error) {
+	if config.Addr == "" {
+		return nil, errors.New("Scribe collector address is required")
+	}
+	if config.BatchSize <= 0 {
+		return nil, errors.New("Scribe collector batch size must be positive")
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 10 * config.BatchSize
+	}
+	if config.QueueSize < config.BatchSize {
+		return nil, errors.New("Scribe collector queue size must not be smaller than the batch size")
+	}
+	if config.RetryBackoff <= 0 {
+		return nil, errors.New("Scribe collector retry backoff must be positive")
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+
+	sc := &ScribeCollector{
+		config: config,
+		batch:  make([]*scribe.LogEntry, 0, config.BatchSize),
+		full:   make(chan struct{}, 1),
+		close:  make(chan struct{}),
+	}
+	sc.closed.Add(1)
+	go sc.flushLoop()
+	return sc, nil
+}
+
+// Collect buffers the span for the next batch. It fails with ErrQueueFull if
+// QueueSize spans are waiting to be sent already.
+func (sc *ScribeCollector) Collect(span *zipkincore.Span) error {
+	bytes, err := SerializeSpan(span)
+	if err != nil {
+		return err
+	}
+	entry := &scribe.LogEntry{
+		Category: sc.config.Category,
+		Message:  base64.StdEncoding.EncodeToString(bytes),
+	}
+
+	sc.lock.Lock()
+	if sc.closing {
+		sc.lock.Unlock()
+		return errors.New("Scribe collector is closed")
+	}
+	if len(sc.batch) >= sc.config.QueueSize {
+		sc.lock.Unlock()
+		return ErrQueueFull
+	}
+	sc.batch = append(sc.batch, entry)
+	depth := len(sc.batch)
+	sc.lock.Unlock()
+	sc.config.Metrics.QueueDepth(depth)
+
+	if depth >= sc.config.BatchSize {
+		select {
+		case sc.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush sends all buffered spans in batches of at most BatchSize spans. It
+// stops at the first failed batch, which is put back in front of the queue.
+func (sc *ScribeCollector) Flush() error {
+	return sc.flush(true)
+}
+
+func (sc *ScribeCollector) flush(requeue bool) error {
+	for {
+		batch := sc.nextBatch()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := sc.send(batch); err != nil {
+			if requeue {
+				sc.requeue(batch)
+			} else {
+				sc.config.Metrics.SpansDropped(DropReasonCollectorError, len(batch))
+			}
+			return err
+		}
+	}
+}
+
+// nextBatch takes up to BatchSize entries from the buffer.
+func (sc *ScribeCollector) nextBatch() []*scribe.LogEntry {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	size := len(sc.batch)
+	if size > sc.config.BatchSize {
+		size = sc.config.BatchSize
+	}
+	batch := make([]*scribe.LogEntry, size)
+	copy(batch, sc.batch)
+	sc.batch = append(sc.batch[:0], sc.batch[size:]...)
+	sc.config.Metrics.QueueDepth(len(sc.batch))
+	return batch
+}
+
+// requeue puts a failed batch back in front of the spans buffered meanwhile.
+func (sc *ScribeCollector) requeue(batch []*scribe.LogEntry) {
+	sc.lock.Lock()
+	sc.batch = append(batch, sc.batch...)
+	depth := len(sc.batch)
+	sc.lock.Unlock()
+	sc.config.Metrics.QueueDepth(depth)
+}
+
+// Close stops the background sending, makes a last attempt to send whatever
+// is still buffered and closes the connection. Later calls do nothing.
+func (sc *ScribeCollector) Close() error {
+	sc.closeOnce.Do(func() {
+		sc.lock.Lock()
+		sc.closing = true
+		sc.lock.Unlock()
+		close(sc.close)
+		sc.closed.Wait()
+		sc.closeErr = sc.flush(false)
+		if sc.closeErr != nil {
+			// spans behind the failed batch are lost as well
+			if batch := sc.nextBatch(); len(batch) > 0 {
+				sc.config.Metrics.SpansDropped(DropReasonCollectorError, len(batch))
+			}
+		}
+
+		sc.sendLock.Lock()
+		sc.disconnect()
+		sc.sendLock.Unlock()
+	})
+	return sc.closeErr
+}
+
+func (sc *ScribeCollector) flushLoop() {
+	defer sc.closed.Done()
+	var tick <-chan time.Time
+	if sc.config.BatchInterval > 0 {
+		ticker := time.NewTicker(sc.config.BatchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-sc.full:
+		case <-sc.close:
+			return
+		}
+		// keep retrying the re-queued batch, new spans may not arrive to wake the loop
+		for err := sc.Flush(); err != nil; err = sc.Flush() {
+			log.Warningf("[Zipkin] Unable to send spans to scribe %s, retrying in %s: %s", sc.config.Addr,
+				sc.config.RetryBackoff, err)
+			select {
+			case <-time.After(sc.config.RetryBackoff):
+			case <-sc.close:
+				return
+			}
+		}
+	}
+}
+
+// send logs the batch, retrying once on a fresh connection if the current
+// one turns out to be broken.
+func (sc *ScribeCollector) send(batch []*scribe.LogEntry) error {
+	sc.sendLock.Lock()
+	defer sc.sendLock.Unlock()
+
+	reconnected := sc.client == nil
+	for {
+		if sc.client == nil {
+			if err := sc.connect(); err != nil {
+				return err
+			}
+		}
+		log.Debugf("[Zipkin] Sending %d spans to scribe %s", len(batch), sc.config.Addr)
+		result, err := sc.client.Log(batch)
+		if err == nil {
+			if result != scribe.ResultCode_OK {
+				return fmt.Errorf("Scribe %s responded with %s", sc.config.Addr, result)
+			}
+			for _, entry := range batch {
+				sc.config.Metrics.BytesSent(len(entry.Message))
+			}
+			sc.config.Metrics.SpansCollected(len(batch))
+			return nil
+		}
+		sc.disconnect()
+		if reconnected {
+			return err
+		}
+		log.Warningf("[Zipkin] Scribe connection to %s failed, reconnecting: %s", sc.config.Addr, err)
+		reconnected = true
+	}
+}
+
+func (sc *ScribeCollector) connect() error {
+	socket, err := thrift.NewTSocketTimeout(sc.config.Addr, sc.config.Timeout)
+	if err != nil {
+		return err
+	}
+	transport := thrift.NewTFramedTransport(socket)
+	if err := transport.Open(); err != nil {
+		return err
+	}
+	sc.transport = transport
+	sc.client = scribe.NewScribeClientFactory(transport, thrift.NewTBinaryProtocolFactoryDefault())
+	return nil
+}
+
+func (sc *ScribeCollector) disconnect() {
+	if sc.transport != nil {
+		sc.transport.Close()
+	}
+	sc.transport = nil
+	sc.client = nil
+}
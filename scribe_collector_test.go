@@ -0,0 +1,174 @@
+package zipkin
+
+import (
+	"encoding/base64"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"github.com/elodina/go-zipkin/gen-go/scribe"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// fakeScribe answers the first tryLater Log calls with TRY_LATER and records
+// the spans of the others.
+type fakeScribe struct {
+	t        *testing.T
+	lock     sync.Mutex
+	tryLater int
+	calls    int
+	spans    []int64
+}
+
+func (f *fakeScribe) Log(messages []*scribe.LogEntry) (scribe.ResultCode, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls++
+	if f.calls <= f.tryLater {
+		return scribe.ResultCode_TRY_LATER, nil
+	}
+	for _, message := range messages {
+		bytes, err := base64.StdEncoding.DecodeString(message.Message)
+		if err != nil {
+			f.t.Error(err)
+			continue
+		}
+		span, err := DeserializeSpan(bytes)
+		if err != nil {
+			f.t.Error(err)
+			continue
+		}
+		f.spans = append(f.spans, span.ID)
+	}
+	return scribe.ResultCode_OK, nil
+}
+
+func (f *fakeScribe) received() []int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]int64(nil), f.spans...)
+}
+
+// serve runs the generated ScribeProcessor over framed binary connections
+// accepted from listener.
+func (f *fakeScribe) serve(listener net.Listener) {
+	processor := scribe.NewScribeProcessor(f)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			transport := thrift.NewTFramedTransport(thrift.NewTSocketFromConnTimeout(conn, time.Second))
+			defer transport.Close()
+			protocol := thrift.NewTBinaryProtocolTransport(transport)
+			for {
+				if ok, err := processor.Process(protocol, protocol); !ok || err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func newFakeScribe(t *testing.T, tryLater int) (*fakeScribe, string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeScribe{t: t, tryLater: tryLater}
+	go fake.serve(listener)
+	return fake, listener.Addr().String(), func() { listener.Close() }
+}
+
+func newTestScribeCollector(t *testing.T, addr string) *ScribeCollector {
+	config := NewScribeCollectorConfig(addr)
+	config.BatchSize = 2
+	config.BatchInterval = 0
+	config.RetryBackoff = 10 * time.Millisecond
+	collector, err := NewScribeCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector
+}
+
+func TestScribeCollectorRetriesTryLater(t *testing.T) {
+	fake, addr, stop := newFakeScribe(t, 2)
+	defer stop()
+	collector := newTestScribeCollector(t, addr)
+
+	for i := int64(1); i <= 4; i++ {
+		if err := collector.Collect(&zipkincore.Span{ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fake.received()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := collector.Close(); err != nil {
+		t.Error(err)
+	}
+	if spans := fake.received(); len(spans) != 4 || spans[0] != 1 || spans[1] != 2 || spans[2] != 3 || spans[3] != 4 {
+		t.Errorf("Expected spans 1 to 4 in order after TRY_LATER, got %v", spans)
+	}
+}
+
+func TestScribeCollectorRequeuesFailedSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	// nothing listens yet, sending fails
+	listener.Close()
+
+	collector := newTestScribeCollector(t, addr)
+	defer collector.Close()
+	collector.Collect(&zipkincore.Span{ID: 1})
+	if err := collector.Flush(); err == nil {
+		t.Fatal("Flush to a closed port succeeded")
+	}
+	collector.lock.Lock()
+	depth := len(collector.batch)
+	collector.lock.Unlock()
+	if depth != 1 {
+		t.Fatalf("Expected the failed span to be re-queued, %d spans buffered", depth)
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("Unable to listen on the same port again:", err)
+	}
+	fake := &fakeScribe{t: t}
+	go fake.serve(listener)
+	defer listener.Close()
+	if err := collector.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if spans := fake.received(); len(spans) != 1 || spans[0] != 1 {
+		t.Errorf("Expected the re-queued span, got %v", spans)
+	}
+}
+
+func TestScribeCollectorCloseTwice(t *testing.T) {
+	fake, addr, stop := newFakeScribe(t, 0)
+	defer stop()
+	collector := newTestScribeCollector(t, addr)
+	collector.Collect(&zipkincore.Span{ID: 1})
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if spans := fake.received(); len(spans) != 1 {
+		t.Errorf("Expected the buffered span to be sent on Close, got %v", spans)
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 2}); err == nil {
+		t.Error("Collect after Close succeeded")
+	}
+}
@@ -0,0 +1,360 @@
+package zipkin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+const (
+	spoolSegmentPrefix = "spool-"
+	spoolSegmentSuffix = ".log"
+)
+
+type SpoolingCollectorConfig struct {
+	Dir string
+	// MaxBytes caps the disk usage of the spool, the oldest segments are
+	// dropped once it is exceeded.
+	MaxBytes     int64
+	SegmentBytes int64
+	// Replay is retried with exponential backoff from InitialBackoff up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func NewSpoolingCollectorConfig(dir string) *SpoolingCollectorConfig {
+	return &SpoolingCollectorConfig{
+		Dir:            dir,
+		MaxBytes:       100 * 1024 * 1024,
+		SegmentBytes:   4 * 1024 * 1024,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+	}
+}
+
+type spoolSegment struct {
+	seq  int64
+	path string
+	size int64
+}
+
+// SpoolingCollector passes spans to the downstream collector and spools them
+// to disk as length-prefixed binary Thrift once the downstream fails. While
+// spooled spans exist, new spans are appended to the spool as well, so that
+// spans are replayed to the downstream in collection order. Spooled segments
+// left by a previous process are replayed on start.
+type SpoolingCollector struct {
+	downstream Collector
+	config     *SpoolingCollectorConfig
+
+	lock     sync.Mutex
+	segments []*spoolSegment // sealed segments, oldest first
+	active   *spoolSegment
+	file     *os.File
+	nextSeq  int64
+	// replayed counts the spans of the oldest segment already replayed
+	replayed int
+
+	wakeup    chan struct{}
+	close     chan struct{}
+	closed    sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewSpoolingCollector(downstream Collector, config *SpoolingCollectorConfig) (*SpoolingCollector, error) {
+	if config.Dir == "" {
+		return nil, errors.New("Spool directory is required")
+	}
+	if config.SegmentBytes <= 0 || config.MaxBytes < config.SegmentBytes {
+		return nil, errors.New("Spool segment size must be positive and not exceed the max spool size")
+	}
+	if config.InitialBackoff <= 0 || config.MaxBackoff < config.InitialBackoff {
+		return nil, errors.New("Spool backoff must be positive and not exceed the max backoff")
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	sc := &SpoolingCollector{
+		downstream: downstream,
+		config:     config,
+		wakeup:     make(chan struct{}, 1),
+		close:      make(chan struct{}),
+	}
+	if err := sc.loadSegments(); err != nil {
+		return nil, err
+	}
+	sc.closed.Add(1)
+	go sc.replayLoop()
+	if len(sc.segments) > 0 {
+		log.Infof("[Zipkin] Replaying %d spooled segments from %s", len(sc.segments), config.Dir)
+		sc.notify()
+	}
+	return sc, nil
+}
+
+func (sc *SpoolingCollector) Collect(span *zipkincore.Span) error {
+	sc.lock.Lock()
+	spooling := sc.spooling()
+	sc.lock.Unlock()
+
+	if !spooling {
+		err := sc.downstream.Collect(span)
+		if err == nil {
+			return nil
+		}
+		log.Warningf("[Zipkin] Collector failed, spooling spans to %s: %s", sc.config.Dir, err)
+	}
+
+	bytes, err := SerializeSpan(span)
+	if err != nil {
+		return err
+	}
+	sc.lock.Lock()
+	err = sc.append(bytes)
+	sc.lock.Unlock()
+	sc.notify()
+	return err
+}
+
+// Close stops replaying and closes the active segment. Spooled spans stay
+// on disk for the next SpoolingCollector using the directory. Later calls
+// do nothing.
+func (sc *SpoolingCollector) Close() error {
+	sc.closeOnce.Do(func() {
+		close(sc.close)
+		sc.closed.Wait()
+
+		sc.lock.Lock()
+		sc.closeErr = sc.seal()
+		sc.lock.Unlock()
+	})
+	return sc.closeErr
+}
+
+// spooling reports whether spans are waiting on disk. Must be called with the lock held.
+func (sc *SpoolingCollector) spooling() bool {
+	return len(sc.segments) > 0 || sc.active != nil
+}
+
+func (sc *SpoolingCollector) append(bytes []byte) error {
+	if sc.active != nil && sc.active.size >= sc.config.SegmentBytes {
+		if err := sc.seal(); err != nil {
+			return err
+		}
+	}
+	if sc.active == nil {
+		segment := &spoolSegment{seq: sc.nextSeq, path: sc.segmentPath(sc.nextSeq)}
+		file, err := os.OpenFile(segment.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		sc.nextSeq++
+		sc.active = segment
+		sc.file = file
+	}
+
+	record := make([]byte, 4+len(bytes))
+	binary.BigEndian.PutUint32(record, uint32(len(bytes)))
+	copy(record[4:], bytes)
+	n, err := sc.file.Write(record)
+	sc.active.size += int64(n)
+	sc.enforceLimit()
+	return err
+}
+
+// seal closes the active segment and queues it for replay.
+func (sc *SpoolingCollector) seal() error {
+	if sc.active == nil {
+		return nil
+	}
+	err := sc.file.Close()
+	sc.segments = append(sc.segments, sc.active)
+	sc.active = nil
+	sc.file = nil
+	return err
+}
+
+// enforceLimit drops the oldest sealed segments while the spool exceeds MaxBytes.
+func (sc *SpoolingCollector) enforceLimit() {
+	total := int64(0)
+	if sc.active != nil {
+		total = sc.active.size
+	}
+	for _, segment := range sc.segments {
+		total += segment.size
+	}
+	for total > sc.config.MaxBytes && len(sc.segments) > 0 {
+		oldest := sc.segments[0]
+		log.Warningf("[Zipkin] Spool %s exceeds %d bytes, dropping %d bytes of the oldest spans", sc.config.Dir,
+			sc.config.MaxBytes, oldest.size)
+		if err := os.Remove(oldest.path); err != nil {
+			log.Warningf("[Zipkin] Unable to remove spool segment %s: %s", oldest.path, err)
+		}
+		sc.segments = sc.segments[1:]
+		sc.replayed = 0
+		total -= oldest.size
+	}
+}
+
+func (sc *SpoolingCollector) notify() {
+	select {
+	case sc.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (sc *SpoolingCollector) replayLoop() {
+	defer sc.closed.Done()
+	backoff := sc.config.InitialBackoff
+	for {
+		select {
+		case <-sc.wakeup:
+		case <-sc.close:
+			return
+		}
+
+		for {
+			err := sc.replay()
+			if err == nil {
+				backoff = sc.config.InitialBackoff
+				break
+			}
+			log.Warningf("[Zipkin] Unable to replay spooled spans, retrying in %s: %s", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-sc.close:
+				return
+			}
+			backoff *= 2
+			if backoff > sc.config.MaxBackoff {
+				backoff = sc.config.MaxBackoff
+			}
+		}
+	}
+}
+
+// replay sends spooled segments to the downstream, oldest first, until the
+// spool is empty.
+func (sc *SpoolingCollector) replay() error {
+	for {
+		sc.lock.Lock()
+		if len(sc.segments) == 0 {
+			if sc.active == nil {
+				sc.lock.Unlock()
+				return nil
+			}
+			if err := sc.seal(); err != nil {
+				sc.lock.Unlock()
+				return err
+			}
+		}
+		segment := sc.segments[0]
+		skip := sc.replayed
+		sc.lock.Unlock()
+
+		sent, err := sc.replaySegment(segment, skip)
+
+		sc.lock.Lock()
+		if len(sc.segments) == 0 || sc.segments[0] != segment {
+			// the segment was dropped to enforce the size limit meanwhile
+			sc.lock.Unlock()
+			continue
+		}
+		if err != nil {
+			sc.replayed = skip + sent
+			sc.lock.Unlock()
+			return err
+		}
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			// keep the segment to retry the removal, a segment left on disk
+			// would be replayed again by the next process
+			sc.replayed = skip + sent
+			if os.Truncate(segment.path, 0) == nil {
+				sc.replayed = 0
+				segment.size = 0
+			}
+			sc.lock.Unlock()
+			return fmt.Errorf("Unable to remove replayed spool segment %s: %s", segment.path, err)
+		}
+		sc.segments = sc.segments[1:]
+		sc.replayed = 0
+		sc.lock.Unlock()
+	}
+}
+
+func (sc *SpoolingCollector) replaySegment(segment *spoolSegment, skip int) (int, error) {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	index, sent := 0, 0
+	var collectErr error
+	err = readThriftSpans(bufio.NewReader(file), func(span *zipkincore.Span) error {
+		index++
+		if index <= skip {
+			return nil
+		}
+		if collectErr = sc.downstream.Collect(span); collectErr != nil {
+			return collectErr
+		}
+		sent++
+		return nil
+	})
+	if err != nil && collectErr == nil {
+		// a record torn by a crash can't be recovered, skip the rest of the segment
+		log.Warningf("[Zipkin] Spool segment %s is corrupt after %d spans: %s", segment.path, index, err)
+		return sent, nil
+	}
+	return sent, err
+}
+
+func (sc *SpoolingCollector) loadSegments() error {
+	files, err := ioutil.ReadDir(sc.config.Dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix),
+			spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		sc.segments = append(sc.segments, &spoolSegment{seq: seq, path: filepath.Join(sc.config.Dir, name),
+			size: file.Size()})
+	}
+	sort.Slice(sc.segments, func(i, j int) bool {
+		return sc.segments[i].seq < sc.segments[j].seq
+	})
+	if len(sc.segments) > 0 {
+		sc.nextSeq = sc.segments[len(sc.segments)-1].seq + 1
+	}
+	sc.enforceLimit()
+	return nil
+}
+
+func (sc *SpoolingCollector) segmentPath(seq int64) string {
+	return filepath.Join(sc.config.Dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
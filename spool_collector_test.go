@@ -0,0 +1,114 @@
+package zipkin
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// flakyCollector fails while down and records the spans it accepts.
+type flakyCollector struct {
+	lock  sync.Mutex
+	down  bool
+	spans []int64
+}
+
+func (fc *flakyCollector) Collect(span *zipkincore.Span) error {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	if fc.down {
+		return errors.New("down")
+	}
+	fc.spans = append(fc.spans, span.ID)
+	return nil
+}
+
+func (fc *flakyCollector) setDown(down bool) {
+	fc.lock.Lock()
+	fc.down = down
+	fc.lock.Unlock()
+}
+
+func (fc *flakyCollector) received() []int64 {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	return append([]int64(nil), fc.spans...)
+}
+
+func TestSpoolingCollectorReplaysInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	downstream := &flakyCollector{down: true}
+	config := NewSpoolingCollectorConfig(dir)
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 10 * time.Millisecond
+	collector, err := NewSpoolingCollector(downstream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+
+	for i := int64(1); i <= 3; i++ {
+		if err := collector.Collect(&zipkincore.Span{ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	downstream.setDown(false)
+	if err := collector.Collect(&zipkincore.Span{ID: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(downstream.received()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	spans := downstream.received()
+	if len(spans) != 4 || spans[0] != 1 || spans[3] != 4 {
+		t.Errorf("Expected spans 1 to 4 in order, got %v", spans)
+	}
+	for time.Now().Before(deadline) {
+		if segments, _ := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*")); len(segments) == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Replayed segments were not removed")
+}
+
+func TestSpoolingCollectorCloseTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	downstream := &flakyCollector{down: true}
+	collector, err := NewSpoolingCollector(downstream, NewSpoolingCollectorConfig(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Close(); err != nil {
+		t.Errorf("Second Close returned %s", err)
+	}
+	segments, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Errorf("Expected the span to stay spooled in one segment, found %v", segments)
+	}
+}
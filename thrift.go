@@ -1,16 +1,259 @@
 package zipkin
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
 	"git.apache.org/thrift.git/lib/go/thrift"
 	"github.com/elodina/go-zipkin/gen-go/zipkincore"
 )
 
 func SerializeSpan(s *zipkincore.Span) ([]byte, error) {
+	return AppendSpan(nil, s)
+}
+
+// AppendSpan appends the binary Thrift span to dst and returns the extended
+// slice. Buffer and protocol come from a pool, so serializing into a dst with
+// enough capacity does not allocate.
+func AppendSpan(dst []byte, s *zipkincore.Span) ([]byte, error) {
+	e := spanEncoderPool.Get().(*pooledSpanEncoder)
+	defer e.release()
+	e.buffer.Reset()
+	if err := s.Write(e.protocol); err != nil {
+		return nil, err
+	}
+	return append(dst, e.buffer.Bytes()...), nil
+}
+
+func SerializeSpanList(spans []*zipkincore.Span) ([]byte, error) {
+	return serializeSpanList(spans, newBinaryProtocol)
+}
+
+// SerializeSpanCompact writes the span with the Thrift compact protocol,
+// which is smaller than the binary one.
+func SerializeSpanCompact(s *zipkincore.Span) ([]byte, error) {
+	return serializeSpan(s, newCompactProtocol)
+}
+
+func SerializeSpanListCompact(spans []*zipkincore.Span) ([]byte, error) {
+	return serializeSpanList(spans, newCompactProtocol)
+}
+
+type pooledSpanEncoder struct {
+	buffer   *thrift.TMemoryBuffer
+	protocol thrift.TProtocol
+}
+
+// maxPooledSpanBufferSize keeps a single huge span from pinning its buffer in
+// the pool for the life of the process.
+const maxPooledSpanBufferSize = 64 * 1024
+
+// release returns the encoder to the pool unless its buffer grew too large.
+func (e *pooledSpanEncoder) release() {
+	if e.buffer.Cap() > maxPooledSpanBufferSize {
+		return
+	}
+	spanEncoderPool.Put(e)
+}
+
+var spanEncoderPool = sync.Pool{
+	New: func() interface{} {
+		buffer := thrift.NewTMemoryBufferLen(1024)
+		return &pooledSpanEncoder{buffer: buffer, protocol: newBinaryProtocol(buffer)}
+	},
+}
+
+func newBinaryProtocol(t thrift.TTransport) thrift.TProtocol {
+	return thrift.NewTBinaryProtocolTransport(t)
+}
+
+func newCompactProtocol(t thrift.TTransport) thrift.TProtocol {
+	return thrift.NewTCompactProtocol(t)
+}
+
+func serializeSpan(s *zipkincore.Span, newProtocol func(thrift.TTransport) thrift.TProtocol) ([]byte, error) {
 	t := thrift.NewTMemoryBuffer()
-	p := thrift.NewTBinaryProtocolTransport(t)
+	p := newProtocol(t)
 	err := s.Write(p)
 	if err != nil {
 		return nil, err
 	}
 	return t.Buffer.Bytes(), nil
 }
+
+func serializeSpanList(spans []*zipkincore.Span, newProtocol func(thrift.TTransport) thrift.TProtocol) ([]byte, error) {
+	t := thrift.NewTMemoryBuffer()
+	p := newProtocol(t)
+	if err := p.WriteListBegin(thrift.STRUCT, len(spans)); err != nil {
+		return nil, err
+	}
+	for _, s := range spans {
+		if err := s.Write(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.WriteListEnd(); err != nil {
+		return nil, err
+	}
+	return t.Buffer.Bytes(), nil
+}
+
+// MaxSpanMessageSize bounds the input of DeserializeSpan and DeserializeSpanList.
+const MaxSpanMessageSize = 16 * 1024 * 1024
+
+var ErrSpanMessageTooLarge = fmt.Errorf("Span message exceeds %d bytes", MaxSpanMessageSize)
+
+// DeserializeSpan decodes a Thrift span as written by SerializeSpan or
+// SerializeSpanCompact, detecting the protocol. Truncated, oversized or
+// otherwise corrupt input returns an error; list sizes are checked against
+// the remaining input before anything is allocated for them, so allocations
+// are bounded by the input size.
+func DeserializeSpan(data []byte) (*zipkincore.Span, error) {
+	// a binary struct starts with a field type, a compact one with a field id delta in the high nibble
+	compact := len(data) > 0 && data[0]&0xf0 != 0
+	p, t, err := newBoundedProtocol(data, compact)
+	if err != nil {
+		return nil, err
+	}
+	span := zipkincore.NewSpan()
+	if err := span.Read(p); err != nil {
+		return nil, err
+	}
+	if remaining := t.RemainingBytes(); remaining > 0 {
+		return nil, fmt.Errorf("Unexpected %d bytes after span", remaining)
+	}
+	return span, nil
+}
+
+// DeserializeSpanList decodes a Thrift list of spans as written by
+// SerializeSpanList or SerializeSpanListCompact, with the same safeguards as
+// DeserializeSpan.
+func DeserializeSpanList(data []byte) ([]*zipkincore.Span, error) {
+	// a binary list header is the element type followed by a 4 byte size, a
+	// compact one packs a small size into the high nibble or is a lone byte if empty
+	compact := len(data) == 1 || (len(data) > 0 && data[0]&0xf0 != 0)
+	p, t, err := newBoundedProtocol(data, compact)
+	if err != nil {
+		return nil, err
+	}
+	elemType, size, err := p.ReadListBegin()
+	if err != nil {
+		return nil, err
+	}
+	if elemType != thrift.STRUCT {
+		return nil, fmt.Errorf("Expected a list of span structs, got a list of %s", elemType)
+	}
+	spans := make([]*zipkincore.Span, 0, size)
+	for i := 0; i < size; i++ {
+		span := zipkincore.NewSpan()
+		if err := span.Read(p); err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	if err := p.ReadListEnd(); err != nil {
+		return nil, err
+	}
+	if remaining := t.RemainingBytes(); remaining > 0 {
+		return nil, fmt.Errorf("Unexpected %d bytes after span list", remaining)
+	}
+	return spans, nil
+}
+
+func newBoundedProtocol(data []byte, compact bool) (thrift.TProtocol, *thrift.TMemoryBuffer, error) {
+	if len(data) > MaxSpanMessageSize {
+		return nil, nil, ErrSpanMessageTooLarge
+	}
+	t := &thrift.TMemoryBuffer{Buffer: bytes.NewBuffer(data)}
+	if compact {
+		return &boundedProtocol{newCompactProtocol(t), t, true}, t, nil
+	}
+	return &boundedProtocol{newBinaryProtocol(t), t, false}, t, nil
+}
+
+// boundedProtocol rejects containers claiming more elements than there are
+// bytes left, as every element takes at least one byte, and strings and
+// binaries longer than the bytes left. The protocols allocate the claimed
+// length before reading, so both are checked before delegating.
+type boundedProtocol struct {
+	thrift.TProtocol
+	t       *thrift.TMemoryBuffer
+	compact bool
+}
+
+func (p *boundedProtocol) ReadString() (string, error) {
+	if err := p.checkLength(); err != nil {
+		return "", err
+	}
+	return p.TProtocol.ReadString()
+}
+
+func (p *boundedProtocol) ReadBinary() ([]byte, error) {
+	if err := p.checkLength(); err != nil {
+		return nil, err
+	}
+	return p.TProtocol.ReadBinary()
+}
+
+// checkLength peeks at the length prefix of the next string or binary, a
+// varint in the compact protocol and a big endian int32 in the binary one.
+// Prefixes which can't be parsed are left to the protocol to report.
+func (p *boundedProtocol) checkLength() error {
+	data := p.t.Bytes()
+	var length uint64
+	var n int
+	if p.compact {
+		if length, n = binary.Uvarint(data); n <= 0 {
+			return nil
+		}
+	} else {
+		if len(data) < 4 {
+			return nil
+		}
+		size := int32(binary.BigEndian.Uint32(data))
+		if size < 0 {
+			return thrift.NewTProtocolExceptionWithType(thrift.NEGATIVE_SIZE,
+				fmt.Errorf("Negative string length %d", size))
+		}
+		length, n = uint64(size), 4
+	}
+	if remaining := uint64(len(data) - n); length > remaining {
+		return thrift.NewTProtocolExceptionWithType(thrift.SIZE_LIMIT,
+			fmt.Errorf("String of %d bytes exceeds the %d remaining bytes", length, remaining))
+	}
+	return nil
+}
+
+func (p *boundedProtocol) ReadListBegin() (thrift.TType, int, error) {
+	elemType, size, err := p.TProtocol.ReadListBegin()
+	if err == nil {
+		err = p.check(size)
+	}
+	return elemType, size, err
+}
+
+func (p *boundedProtocol) ReadSetBegin() (thrift.TType, int, error) {
+	elemType, size, err := p.TProtocol.ReadSetBegin()
+	if err == nil {
+		err = p.check(size)
+	}
+	return elemType, size, err
+}
+
+func (p *boundedProtocol) ReadMapBegin() (thrift.TType, thrift.TType, int, error) {
+	keyType, valueType, size, err := p.TProtocol.ReadMapBegin()
+	if err == nil {
+		err = p.check(2 * size)
+	}
+	return keyType, valueType, size, err
+}
+
+func (p *boundedProtocol) check(size int) error {
+	if size < 0 || uint64(size) > p.t.RemainingBytes() {
+		return thrift.NewTProtocolExceptionWithType(thrift.SIZE_LIMIT,
+			fmt.Errorf("Container of %d elements exceeds the %d remaining bytes", size, p.t.RemainingBytes()))
+	}
+	return nil
+}
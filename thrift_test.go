@@ -0,0 +1,159 @@
+package zipkin
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+func fuzzSeedSpan() *zipkincore.Span {
+	parentID := int64(1)
+	return &zipkincore.Span{
+		TraceID:  1,
+		ParentID: &parentID,
+		ID:       2,
+		Name:     "seed",
+		Annotations: []*zipkincore.Annotation{
+			{Timestamp: 1000, Value: zipkincore.CLIENT_SEND, Host: &zipkincore.Endpoint{ServiceName: "seed"}},
+		},
+		BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+			NewBinaryAnnotation("key", "value", nil),
+		},
+	}
+}
+
+func TestDeserializeSpanRejectsOversizedStrings(t *testing.T) {
+	for name, data := range map[string][]byte{
+		// field 3 (name) of type string claiming 1 GiB
+		"binary": {0x0b, 0x00, 0x03, 0x40, 0x00, 0x00, 0x00, 'a'},
+		// field delta 3 of type binary claiming 1 GiB
+		"compact": {0x38, 0x80, 0x80, 0x80, 0x80, 0x04, 'a'},
+		// negative length
+		"negative": {0x0b, 0x00, 0x03, 0xff, 0xff, 0xff, 0xff, 'a'},
+	} {
+		if _, err := DeserializeSpan(data); err == nil {
+			t.Errorf("%s: oversized string accepted", name)
+		}
+	}
+}
+
+func TestDecodeSpansDetectsProtocol(t *testing.T) {
+	span := fuzzSeedSpan()
+	binarySpan, _ := ThriftEncoder{}.EncodeSpan(span)
+	compactSpan, _ := CompactThriftEncoder{}.EncodeSpan(span)
+	if bytes.Equal(binarySpan, compactSpan) {
+		t.Fatal("Binary and compact encodings are identical")
+	}
+	for name, encoder := range map[string]SpanEncoder{
+		"binary":  ThriftEncoder{},
+		"compact": CompactThriftEncoder{},
+		"json":    JSONEncoder{},
+	} {
+		single, err := encoder.EncodeSpan(span)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeSpans(single)
+		if err != nil {
+			t.Fatalf("%s span: %s", name, err)
+		}
+		if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], span) {
+			t.Errorf("%s span decoded as %v", name, decoded)
+		}
+
+		list, err := encoder.EncodeSpans([]*zipkincore.Span{span, span})
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err = DecodeSpans(list)
+		if err != nil {
+			t.Fatalf("%s span list: %s", name, err)
+		}
+		if len(decoded) != 2 || !reflect.DeepEqual(decoded[1], span) {
+			t.Errorf("%s span list decoded as %v", name, decoded)
+		}
+	}
+}
+
+func FuzzDeserializeSpan(f *testing.F) {
+	span := fuzzSeedSpan()
+	for _, encoder := range []SpanEncoder{ThriftEncoder{}, CompactThriftEncoder{}, JSONEncoder{}} {
+		single, err := encoder.EncodeSpan(span)
+		if err != nil {
+			f.Fatal(err)
+		}
+		list, err := encoder.EncodeSpans([]*zipkincore.Span{span, span})
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(single)
+		f.Add(list)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// none of the decoders may panic or allocate beyond the input size
+		DeserializeSpan(data)
+		DeserializeSpanList(data)
+		DeserializeSpanJSON(data)
+		DeserializeSpanListJSON(data)
+		DecodeSpans(data)
+	})
+}
+
+func TestAppendSpanDropsOversizedBuffers(t *testing.T) {
+	span := fuzzSeedSpan()
+	span.Name = string(make([]byte, 2*maxPooledSpanBufferSize))
+	if _, err := SerializeSpan(span); err != nil {
+		t.Fatal(err)
+	}
+	e := spanEncoderPool.Get().(*pooledSpanEncoder)
+	defer e.release()
+	if e.buffer.Cap() > maxPooledSpanBufferSize {
+		t.Errorf("Pooled buffer has capacity %d, want at most %d", e.buffer.Cap(), maxPooledSpanBufferSize)
+	}
+}
+
+// BenchmarkSerializeSpanUnpooled measures the previous path, which built a new
+// buffer and protocol for every span.
+func BenchmarkSerializeSpanUnpooled(b *testing.B) {
+	span := fuzzSeedSpan()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := serializeSpan(span, newBinaryProtocol); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerializeSpan(b *testing.B) {
+	span := fuzzSeedSpan()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := SerializeSpan(span); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendSpan(b *testing.B) {
+	span := fuzzSeedSpan()
+	buffer := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buffer, err = AppendSpan(buffer[:0], span); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSpanLifecycle(b *testing.B) {
+	tracer := NewTracerWithOptions("service", WithEndpoint("127.0.0.1", 0))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		span := tracer.NewSpan("request")
+		span.ClientSend()
+		span.ClientReceiveAndCollect()
+	}
+}
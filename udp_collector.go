@@ -0,0 +1,181 @@
+package zipkin
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/yanzay/log"
+)
+
+var (
+	ErrSpanTooLarge = errors.New("Serialized span does not fit into a datagram")
+	ErrQueueFull    = errors.New("Collector queue is full")
+)
+
+// binary Thrift list header: element type byte and int32 size
+const thriftListHeaderSize = 5
+
+type UDPCollectorConfig struct {
+	Addr string
+	// MaxPacketSize limits the datagram size, list header included.
+	MaxPacketSize int
+	QueueSize     int
+	BatchInterval time.Duration
+	// Metrics receives the bytes sent, the queue depth and spans lost by failed sends.
+	Metrics Metrics
+}
+
+func NewUDPCollectorConfig(addr string) *UDPCollectorConfig {
+	return &UDPCollectorConfig{
+		Addr:          addr,
+		MaxPacketSize: 65000,
+		QueueSize:     1000,
+		BatchInterval: time.Second,
+		Metrics:       NoopMetrics{},
+	}
+}
+
+// UDPCollector packs binary Thrift spans into list datagrams sent to a local
+// agent. Collect never blocks: spans which do not fit into a datagram or
+// arrive while the queue is full are dropped and reported as errors.
+type UDPCollector struct {
+	config *UDPCollectorConfig
+	conn   net.Conn
+	queue  chan []byte
+
+	pending     [][]byte
+	pendingSize int
+
+	lock    sync.RWMutex // guards closing against Collect
+	closing bool
+	close   chan struct{}
+	closed  sync.WaitGroup
+}
+
+func NewUDPCollector(config *UDPCollectorConfig) (*UDPCollector, error) {
+	if config.MaxPacketSize <= thriftListHeaderSize {
+		return nil, errors.New("UDP collector max packet size is too small")
+	}
+	if config.QueueSize <= 0 {
+		return nil, errors.New("UDP collector queue size must be positive")
+	}
+	if config.BatchInterval <= 0 {
+		return nil, errors.New("UDP collector batch interval must be positive")
+	}
+	if config.Metrics == nil {
+		config.Metrics = NoopMetrics{}
+	}
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	uc := &UDPCollector{
+		config: config,
+		conn:   conn,
+		queue:  make(chan []byte, config.QueueSize),
+		close:  make(chan struct{}),
+	}
+	uc.closed.Add(1)
+	go uc.sendLoop()
+	return uc, nil
+}
+
+func (uc *UDPCollector) Collect(span *zipkincore.Span) error {
+	bytes, err := SerializeSpan(span)
+	if err != nil {
+		return err
+	}
+	if len(bytes)+thriftListHeaderSize > uc.config.MaxPacketSize {
+		log.Warningf("[Zipkin] Dropping span %s of %d bytes, max packet size is %d", span.Name, len(bytes),
+			uc.config.MaxPacketSize)
+		return ErrSpanTooLarge
+	}
+	uc.lock.RLock()
+	defer uc.lock.RUnlock()
+	if uc.closing {
+		return errors.New("UDP collector is closed")
+	}
+	select {
+	case uc.queue <- bytes:
+		uc.config.Metrics.QueueDepth(len(uc.queue))
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close sends the queued spans and closes the socket. Later calls do nothing.
+func (uc *UDPCollector) Close() error {
+	uc.lock.Lock()
+	if uc.closing {
+		uc.lock.Unlock()
+		return nil
+	}
+	uc.closing = true
+	uc.lock.Unlock()
+	close(uc.close)
+	uc.closed.Wait()
+	return uc.conn.Close()
+}
+
+func (uc *UDPCollector) sendLoop() {
+	defer uc.closed.Done()
+	ticker := time.NewTicker(uc.config.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case bytes := <-uc.queue:
+			uc.add(bytes)
+		case <-ticker.C:
+			uc.flush()
+		case <-uc.close:
+			for {
+				select {
+				case bytes := <-uc.queue:
+					uc.add(bytes)
+				default:
+					uc.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (uc *UDPCollector) add(bytes []byte) {
+	if thriftListHeaderSize+uc.pendingSize+len(bytes) > uc.config.MaxPacketSize {
+		uc.flush()
+	}
+	uc.pending = append(uc.pending, bytes)
+	uc.pendingSize += len(bytes)
+}
+
+func (uc *UDPCollector) flush() {
+	if len(uc.pending) == 0 {
+		return
+	}
+	buffer := thrift.NewTMemoryBufferLen(thriftListHeaderSize + uc.pendingSize)
+	protocol := thrift.NewTBinaryProtocolTransport(buffer)
+	protocol.WriteListBegin(thrift.STRUCT, len(uc.pending))
+	for _, bytes := range uc.pending {
+		buffer.Write(bytes)
+	}
+	protocol.WriteListEnd()
+
+	log.Debugf("[Zipkin] Sending %d spans in a %d bytes datagram", len(uc.pending), buffer.Len())
+	if n, err := uc.conn.Write(buffer.Bytes()); err != nil {
+		log.Warningf("[Zipkin] Unable to send %d spans to %s: %s", len(uc.pending), uc.config.Addr, err)
+		uc.config.Metrics.SpansDropped(DropReasonCollectorError, len(uc.pending))
+	} else {
+		uc.config.Metrics.BytesSent(n)
+		uc.config.Metrics.SpansCollected(len(uc.pending))
+	}
+	uc.config.Metrics.QueueDepth(len(uc.queue))
+	uc.pending = uc.pending[:0]
+	uc.pendingSize = 0
+}
@@ -0,0 +1,102 @@
+package zipkin
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+func newTestUDPCollector(t *testing.T, maxPacketSize int) (*UDPCollector, *net.UDPConn) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	config := NewUDPCollectorConfig(listener.LocalAddr().String())
+	config.MaxPacketSize = maxPacketSize
+	config.BatchInterval = time.Hour
+	collector, err := NewUDPCollector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collector, listener
+}
+
+func TestUDPCollectorPacksDatagrams(t *testing.T) {
+	spanSize := len(mustSerializeSpan(t, &zipkincore.Span{ID: 1, Name: "span"}))
+	maxPacketSize := thriftListHeaderSize + 2*spanSize
+	collector, listener := newTestUDPCollector(t, maxPacketSize)
+
+	for i := int64(1); i <= 5; i++ {
+		if err := collector.Collect(&zipkincore.Span{ID: i, Name: "span"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	var ids []int64
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	buffer := make([]byte, 65536)
+	for len(ids) < 5 {
+		n, err := listener.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > maxPacketSize {
+			t.Errorf("Datagram of %d bytes exceeds %d", n, maxPacketSize)
+		}
+		spans, err := DeserializeSpanList(buffer[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(spans))
+		for _, span := range spans {
+			ids = append(ids, span.ID)
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("Expected datagrams of 2, 2 and 1 spans, got %v", sizes)
+	}
+	for i, id := range ids {
+		if id != int64(i+1) {
+			t.Errorf("Expected spans 1 to 5 in order, got %v", ids)
+			break
+		}
+	}
+}
+
+func TestUDPCollectorSpanTooLarge(t *testing.T) {
+	collector, _ := newTestUDPCollector(t, 100)
+	defer collector.Close()
+
+	if err := collector.Collect(&zipkincore.Span{Name: string(make([]byte, 100))}); err != ErrSpanTooLarge {
+		t.Errorf("Expected ErrSpanTooLarge, got %v", err)
+	}
+}
+
+func TestUDPCollectorClose(t *testing.T) {
+	collector, _ := newTestUDPCollector(t, 1000)
+
+	if err := collector.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := collector.Close(); err != nil {
+		t.Errorf("Second Close failed: %s", err)
+	}
+	if err := collector.Collect(&zipkincore.Span{ID: 1}); err == nil {
+		t.Error("Collect after Close succeeded")
+	}
+}
+
+func mustSerializeSpan(t *testing.T, span *zipkincore.Span) []byte {
+	bytes, err := SerializeSpan(span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes
+}
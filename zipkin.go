@@ -1,7 +1,9 @@
 package zipkin
 
 import (
-	"math/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -11,52 +13,60 @@ import (
 	"github.com/yanzay/log"
 	"net"
 	"errors"
-	"encoding/binary"
-	"bytes"
 	"github.com/elodina/go-avro"
 )
 
 var localhost int32 = 127 * 256 * 256 * 256 + 1
 
+// Collector receives finished spans. Earlier versions passed spans
+// serialized with binary Thrift to Collect([]byte), such implementations are
+// wrapped in LegacyCollectorAdapter.
 type Collector interface {
-	Collect([]byte)
+	Collect(span *zipkincore.Span) error
 }
 
 type Tracer struct {
 	collector   Collector
-	ip          int32
+	// endpoint is shared by the annotations of all spans, it must not be modified
+	endpoint    *zipkincore.Endpoint
+	ip          string // set by WithEndpoint, resolved to endpoint once all options are applied
 	port        int16
 	serviceName string
-	rate        int
+	sampler     Sampler
+	idGenerator IDGenerator
+	clock       Clock
+	logger      Logger
+	propagators []Propagator
+	metrics     Metrics
 }
 
 func NewTracer(serviceName string, rate int, producer *producer.KafkaProducer, ip string, port int16, topic string) *Tracer {
 	log.Infof("[Zipkin] Creating new tracer for service %s with rate 1:%d, topic %s, ip %s, port %d", serviceName, rate,
 		topic, ip, port)
-	collector := &KafkaCollector{producer: producer, topic: topic}
-
-	convertedIp, err := convertIp(ip); if err != nil {
-		log.Warningf("Given ip %s is not a valid ipv4 ip address, going with localhost ip")
-		convertedIp = &localhost
+	collector := NewKafkaCollector(producer, topic, ThriftEncoder{})
+	return NewTracerWithOptions(serviceName, WithCollector(collector), WithSampler(NewRateSampler(rate)),
+		WithEndpoint(ip, port))
+}
+
+// NewTracerWithOptions creates a tracer which by default samples every trace,
+// discards collected spans, reports LocalNetworkIP() and DefaultPort() as its
+// endpoint and propagates trace context in B3 headers and Avro TraceInfo records.
+func NewTracerWithOptions(serviceName string, options ...TracerOption) *Tracer {
+	tracer := &Tracer{
+		collector:   NoopCollector{},
+		serviceName: serviceName,
+		sampler:     AlwaysSample,
+		idGenerator: defaultIDGenerator,
+		clock:       time.Now,
+		logger:      defaultLogger{},
+		propagators: []Propagator{B3Propagator{}, AvroPropagator{}},
+		metrics:     NoopMetrics{},
 	}
-
-	tracer := &Tracer{ip: *convertedIp, port: port, collector: collector, rate: rate, serviceName: serviceName}
-	return tracer
-}
-
-func convertIp(ip string) (*int32, error) {
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return nil, errors.New("Unable to parse given ip")
-	}
-
-	var ipInInt int32
-	buf := bytes.NewReader([]byte{parsedIP[0], parsedIP[1], parsedIP[2], parsedIP[3]})
-	err := binary.Read(buf, binary.LittleEndian, &ipInInt); if err == nil {
-		return &ipInInt, nil
-	} else {
-		return nil, err
+	for _, option := range options {
+		option(tracer)
 	}
+	tracer.endpoint = tracer.newEndpoint()
+	return tracer
 }
 
 func DefaultTopic() string {
@@ -81,15 +91,35 @@ func DefaultProducer(brokerList []string) (*producer.KafkaProducer, error) {
 }
 
 func LocalNetworkIP() string {
+	return localNetworkIP(defaultLogger{})
+}
+
+func localNetworkIP(logger Logger) string {
 	ip, err := determineLocalIp()
 	if err == nil {
 		return ip
 	} else {
-		log.Warningf("Unable to determine local network IP address, going with localhost IP")
+		logger.Warningf("Unable to determine local network IP address, going with localhost IP")
 		return "127.0.0.1"
 	}
 }
 
+// newEndpoint encodes the address given by WithEndpoint, LocalNetworkIP()
+// if there is none. The address is stored as a big endian int32 as defined
+// in zipkinCore.thrift, so 10.0.0.1 becomes 0x0a000001.
+func (t *Tracer) newEndpoint() *zipkincore.Endpoint {
+	ip := t.ip
+	if ip == "" {
+		ip = localNetworkIP(t.logger)
+	}
+	convertedIp, err := parseIPv4(ip)
+	if err != nil {
+		t.logger.Warningf("[Zipkin] Given ip %s is not a valid ipv4 ip address, going with localhost ip", ip)
+		convertedIp = localhost
+	}
+	return &zipkincore.Endpoint{ServiceName: t.serviceName, Ipv4: convertedIp, Port: t.port}
+}
+
 func determineLocalIp() (string, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -128,40 +158,42 @@ func determineLocalIp() (string, error) {
 }
 
 func (t *Tracer) NewSpan(name string) *Span {
-	log.Debugf("[Zipkin] Creating new span: %s", name)
-	sampled := rand.Intn(t.rate) == 0
-	if !sampled {
-		return &Span{sampled: false}
-	}
-	span := newSpan(name, newID(), newID(), nil, t.serviceName)
-	span.collector = t.collector
-	span.port = t.port
-	span.ip = t.ip
+	t.logger.Debugf("[Zipkin] Creating new span: %s", name)
+	traceID := t.idGenerator()
+	if !t.sampler(traceID) {
+		return t.unsampledSpan()
+	}
+	span := t.newSpan(name, traceID, t.idGenerator(), nil)
 	span.sampled = true
 	return span
 }
 
 type Span struct {
 	sync.Mutex
-	span        *zipkincore.Span
-	collector   Collector
-	ip          int32
-	port        int16
-	sampled     bool
-	serviceName string
+	span    *zipkincore.Span
+	tracer  *Tracer
+	sampled bool
 }
 
-func newSpan(name string, traceID int64, spanId int64, parentID *int64, serviceName string) *Span {
+func (t *Tracer) newSpan(name string, traceID int64, spanId int64, parentID *int64) *Span {
 	zipkinSpan := &zipkincore.Span{
 		Name:              name,
 		ID:                spanId,
 		TraceID:           traceID,
 		ParentID:          parentID,
-		Annotations:       make([]*zipkincore.Annotation, 0),
+		// room for the send and receive annotations most spans have
+		Annotations:       make([]*zipkincore.Annotation, 0, 2),
 		BinaryAnnotations: make([]*zipkincore.BinaryAnnotation, 0),
 	}
 
-	return &Span{span: zipkinSpan, serviceName: serviceName}
+	t.metrics.SpanStarted()
+	t.metrics.SpanSampled()
+	return &Span{span: zipkinSpan, tracer: t}
+}
+
+func (t *Tracer) unsampledSpan() *Span {
+	t.metrics.SpanStarted()
+	return &Span{tracer: t, sampled: false}
 }
 
 func (s *Span) Sampled() bool {
@@ -181,12 +213,12 @@ func (s *Span) ID() int64 {
 }
 
 func (s *Span) ServerReceive() {
-	log.Debugf("[Zipkin] ServerReceive")
+	s.logger().Debugf("[Zipkin] ServerReceive")
 	s.Annotate(zipkincore.SERVER_RECV)
 }
 
 func (s *Span) ServerSend() {
-	log.Debugf("[Zipkin] ServerSend")
+	s.logger().Debugf("[Zipkin] ServerSend")
 	s.Annotate(zipkincore.SERVER_SEND)
 }
 
@@ -201,12 +233,12 @@ func (s *Span) ServerReceiveAndCollect() {
 }
 
 func (s *Span) ClientSend() {
-	log.Debugf("[Zipkin] ClientSend")
+	s.logger().Debugf("[Zipkin] ClientSend")
 	s.Annotate(zipkincore.CLIENT_SEND)
 }
 
 func (s *Span) ClientReceive() {
-	log.Debugf("[Zipkin] ClientReceive")
+	s.logger().Debugf("[Zipkin] ClientReceive")
 	s.Annotate(zipkincore.CLIENT_RECV)
 }
 
@@ -221,14 +253,14 @@ func (s *Span) ClientSendAndCollect() {
 }
 
 func (s *Span) NewChild(name string) *Span {
-	log.Debugf("[Zipkin] Creating new child span: %s", name)
+	s.logger().Debugf("[Zipkin] Creating new child span: %s", name)
 	if !s.sampled {
-		return &Span{}
+		if s.tracer == nil {
+			return &Span{}
+		}
+		return s.tracer.unsampledSpan()
 	}
-	child := newSpan(name, s.span.TraceID, newID(), &s.span.ID, s.serviceName)
-	child.collector = s.collector
-	child.ip = s.ip
-	child.port = s.port
+	child := s.tracer.newSpan(name, s.span.TraceID, s.tracer.idGenerator(), &s.span.ID)
 	child.sampled = true
 	return child
 }
@@ -269,30 +301,127 @@ func (t *Tracer) NewSpanFromAvro(name string, traceInfo interface{}) *Span {
 }
 
 func (t *Tracer) NewSpanFromRequest(name string, traceId *int64, spanId *int64, parentId *int64, sampled *bool) *Span {
-	nonSampled := &Span{sampled: false}
 	if sampled == nil {
-		log.Debugf("[Zipkin] Empty trace info provided. Ignoring")
-		return nonSampled
+		t.logger.Debugf("[Zipkin] Empty trace info provided. Ignoring")
+		return t.unsampledSpan()
 	}
 	if !*sampled {
-		log.Debugf("[Zipkin] The input trace info not sampled. Ignoring")
-		return nonSampled
+		t.logger.Debugf("[Zipkin] The input trace info not sampled. Ignoring")
+		return t.unsampledSpan()
 	}
 	if spanId == nil || traceId == nil {
-		log.Debugf("[Zipkin] The input trace info incomplete. Ignoring")
-		return nonSampled
+		t.logger.Debugf("[Zipkin] The input trace info incomplete. Ignoring")
+		return t.unsampledSpan()
 	}
 
-	log.Debugf("[Zipkin] Creating new span %s from request: traceID %s, spanID %s, parentID %s, sampled %s", name,
-	traceId, spanId, parentId, sampled)
-	span := newSpan(name, *traceId, *spanId, nil, t.serviceName)
-	span.collector = t.collector
-	span.port = t.port
-	span.ip = t.ip
+	t.logger.Debugf("[Zipkin] Creating new span %s from request: traceID %d, spanID %d, parentID %v, sampled %t", name,
+	*traceId, *spanId, parentId, *sampled)
+	span := t.newSpan(name, *traceId, *spanId, parentId)
 	span.sampled = true
 	return span
 }
 
+// NewChildSpan starts a child of the span described by parent, e.g. one
+// received in a message. Parent's sampling decision is kept, or made by the
+// tracer's sampler if there is none; a parent without ids starts a new trace.
+func (t *Tracer) NewChildSpan(name string, parent SpanContext) *Span {
+	if parent.Sampled != nil && !*parent.Sampled {
+		return t.unsampledSpan()
+	}
+	if parent.TraceID == 0 && parent.SpanID == 0 {
+		if parent.Sampled == nil {
+			return t.NewSpan(name)
+		}
+		traceID := t.idGenerator()
+		span := t.newSpan(name, traceID, t.idGenerator(), nil)
+		span.sampled = true
+		return span
+	}
+	if parent.Sampled == nil && !t.sampler(parent.TraceID) {
+		return t.unsampledSpan()
+	}
+	parentID := parent.SpanID
+	span := t.newSpan(name, parent.TraceID, t.idGenerator(), &parentID)
+	span.sampled = true
+	span.span.Debug = parent.Debug
+	return span
+}
+
+// NewSpanFromCarrier joins the trace propagated in the carrier, e.g. incoming
+// http.Header. A trace context without sampling decision is sampled by the
+// tracer's sampler; a carrier without trace context starts a new trace.
+func (t *Tracer) NewSpanFromCarrier(name string, carrier interface{}) *Span {
+	context, err := t.Extract(carrier)
+	if err != nil {
+		if err != ErrSpanContextNotFound {
+			t.logger.Warningf("[Zipkin] Unable to extract trace context: %s", err)
+		}
+		return t.NewSpan(name)
+	}
+	if context.TraceID == 0 && context.SpanID == 0 {
+		// a bare sampling decision starts a new trace honouring it
+		if !*context.Sampled {
+			return t.unsampledSpan()
+		}
+		traceID := t.idGenerator()
+		span := t.newSpan(name, traceID, t.idGenerator(), nil)
+		span.sampled = true
+		return span
+	}
+	sampled := context.Sampled
+	if sampled == nil {
+		decision := t.sampler(context.TraceID)
+		sampled = &decision
+	}
+	span := t.NewSpanFromRequest(name, &context.TraceID, &context.SpanID, context.ParentID, sampled)
+	if span.sampled && context.Debug {
+		span.span.Debug = true
+	}
+	return span
+}
+
+func (t *Tracer) Extract(carrier interface{}) (*SpanContext, error) {
+	for _, propagator := range t.propagators {
+		context, err := propagator.Extract(carrier)
+		if err != ErrUnsupportedCarrier {
+			return context, err
+		}
+	}
+	return nil, ErrUnsupportedCarrier
+}
+
+func (s *Span) Context() SpanContext {
+	sampled := s.sampled
+	if !s.sampled {
+		return SpanContext{Sampled: &sampled}
+	}
+	return SpanContext{
+		TraceID:  s.span.TraceID,
+		SpanID:   s.span.ID,
+		ParentID: s.span.ParentID,
+		Sampled:  &sampled,
+		Debug:    s.span.Debug,
+	}
+}
+
+// Inject writes the span's trace context to the carrier, e.g. outgoing http.Header.
+func (s *Span) Inject(carrier interface{}) error {
+	if s.tracer == nil {
+		return ErrUnsupportedCarrier
+	}
+	return s.tracer.Inject(s.Context(), carrier)
+}
+
+// Inject writes the trace context to the carrier with the first propagator supporting it.
+func (t *Tracer) Inject(context SpanContext, carrier interface{}) error {
+	for _, propagator := range t.propagators {
+		if err := propagator.Inject(context, carrier); err != ErrUnsupportedCarrier {
+			return err
+		}
+	}
+	return ErrUnsupportedCarrier
+}
+
 func (s *Span) GetAvroTraceInfo() *avro.GenericRecord {
 	if s.sampled {
 		traceInfo := avro.NewGenericRecord(NewTraceInfo().Schema())
@@ -309,43 +438,217 @@ func (s *Span) GetAvroTraceInfo() *avro.GenericRecord {
 }
 
 func (s *Span) Collect() error {
-	log.Debugf("[Zipkin] Sending spans: %b", s.sampled)
+	s.logger().Debugf("[Zipkin] Sending spans: %t", s.sampled)
 	if !s.sampled {
 		return nil
 	}
-	log.Debugf("[Zipkin] Serializing span: %v", s.span)
-	bytes, err := SerializeSpan(s.span)
+	span := s.snapshot()
+	s.logger().Debugf("[Zipkin] Collecting span: %v", span)
+	metrics := s.tracer.metrics
+	metrics.SpanFinished()
+	start := time.Now()
+	err := s.tracer.collector.Collect(span)
+	metrics.CollectLatency(time.Since(start))
 	if err != nil {
-		return err
+		// spans accepted are counted as collected by the collector once sent
+		metrics.SpansDropped(dropReason(err), 1)
 	}
-	s.collector.Collect(bytes)
-	return nil
+	return err
+}
+
+// snapshot copies the span for the collector, which may encode it on its own
+// goroutine while the caller keeps annotating the span.
+func (s *Span) snapshot() *zipkincore.Span {
+	s.Lock()
+	defer s.Unlock()
+	span := *s.span
+	span.Annotations = append([]*zipkincore.Annotation(nil), s.span.Annotations...)
+	span.BinaryAnnotations = append([]*zipkincore.BinaryAnnotation(nil), s.span.BinaryAnnotations...)
+	return &span
 }
 
 func (s *Span) Annotate(value string) {
 	if !s.sampled {
 		return
 	}
-	now := nowMicrosecond()
+	now := s.tracer.nowMicrosecond()
 	annotation := &zipkincore.Annotation{
 		Value:     value,
 		Timestamp: *now,
-		Host: &zipkincore.Endpoint{
-			ServiceName: s.serviceName,
-			Ipv4:        s.ip,
-			Port:        s.port,
-		},
+		Host:      s.tracer.endpoint,
 	}
 	s.Lock()
 	s.span.Annotations = append(s.span.Annotations, annotation)
 	s.Unlock()
 }
 
-func nowMicrosecond() *int64 {
-	now := time.Now().UnixNano() / 1000
-	return &now
+// AnnotateAt records an annotation which happened at the given time.
+func (s *Span) AnnotateAt(value string, timestamp time.Time) {
+	if !s.sampled {
+		return
+	}
+	annotation := &zipkincore.Annotation{
+		Value:     value,
+		Timestamp: timestamp.UnixNano() / 1000,
+		Host:      s.tracer.endpoint,
+	}
+	s.Lock()
+	s.span.Annotations = append(s.span.Annotations, annotation)
+	s.Unlock()
 }
 
-func newID() int64 {
-	return rand.Int63()
+// SetName renames the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	if !s.sampled {
+		return
+	}
+	s.Lock()
+	s.span.Name = name
+	s.Unlock()
+}
+
+// SetTimestamp records when the span started and how long it took, which
+// the creator of a span, rather than one joining it, reports.
+func (s *Span) SetTimestamp(start time.Time, duration time.Duration) {
+	if !s.sampled {
+		return
+	}
+	timestamp := start.UnixNano() / 1000
+	micros := int64(duration / time.Microsecond)
+	s.Lock()
+	s.span.Timestamp = &timestamp
+	s.span.Duration = &micros
+	s.Unlock()
+}
+
+// Tag records a string binary annotation, e.g. zipkincore.HTTP_PATH.
+func (s *Span) Tag(key string, value string) {
+	if !s.sampled {
+		return
+	}
+	s.addBinaryAnnotation(&zipkincore.BinaryAnnotation{
+		Key:            key,
+		Value:          []byte(value),
+		AnnotationType: zipkincore.AnnotationType_STRING,
+		Host:           s.tracer.endpoint,
+	})
+}
+
+// TagValue records a binary annotation typed after the value, see NewBinaryAnnotation.
+func (s *Span) TagValue(key string, value interface{}) {
+	if !s.sampled {
+		return
+	}
+	s.addBinaryAnnotation(NewBinaryAnnotation(key, value, s.tracer.endpoint))
+}
+
+// NewBinaryAnnotation encodes bools, integers, floats, strings and byte
+// slices with the matching annotation type, integers as I16, I32 or I64 after
+// their size. Unsigned integers above math.MaxInt64 and other values are
+// formatted as strings.
+func NewBinaryAnnotation(key string, value interface{}, host *zipkincore.Endpoint) *zipkincore.BinaryAnnotation {
+	annotation := &zipkincore.BinaryAnnotation{Key: key, Host: host}
+	switch v := value.(type) {
+	case bool:
+		annotation.AnnotationType = zipkincore.AnnotationType_BOOL
+		annotation.Value = []byte{0}
+		if v {
+			annotation.Value[0] = 1
+		}
+	case []byte:
+		annotation.AnnotationType = zipkincore.AnnotationType_BYTES
+		annotation.Value = v
+	case string:
+		annotation.AnnotationType = zipkincore.AnnotationType_STRING
+		annotation.Value = []byte(v)
+	case int8:
+		annotation.AnnotationType = zipkincore.AnnotationType_I16
+		annotation.Value = bigEndian(uint64(v), 2)
+	case uint8:
+		annotation.AnnotationType = zipkincore.AnnotationType_I16
+		annotation.Value = bigEndian(uint64(v), 2)
+	case int16:
+		annotation.AnnotationType = zipkincore.AnnotationType_I16
+		annotation.Value = bigEndian(uint64(v), 2)
+	case uint16:
+		annotation.AnnotationType = zipkincore.AnnotationType_I32
+		annotation.Value = bigEndian(uint64(v), 4)
+	case int32:
+		annotation.AnnotationType = zipkincore.AnnotationType_I32
+		annotation.Value = bigEndian(uint64(v), 4)
+	case uint32:
+		annotation.AnnotationType = zipkincore.AnnotationType_I64
+		annotation.Value = bigEndian(uint64(v), 8)
+	case int:
+		annotation.AnnotationType = zipkincore.AnnotationType_I64
+		annotation.Value = bigEndian(uint64(v), 8)
+	case int64:
+		annotation.AnnotationType = zipkincore.AnnotationType_I64
+		annotation.Value = bigEndian(uint64(v), 8)
+	case uint:
+		return NewBinaryAnnotation(key, uint64(v), host)
+	case uint64:
+		if v > math.MaxInt64 {
+			// does not fit the signed I64
+			annotation.AnnotationType = zipkincore.AnnotationType_STRING
+			annotation.Value = []byte(fmt.Sprint(v))
+		} else {
+			annotation.AnnotationType = zipkincore.AnnotationType_I64
+			annotation.Value = bigEndian(v, 8)
+		}
+	case float32:
+		annotation.AnnotationType = zipkincore.AnnotationType_DOUBLE
+		annotation.Value = bigEndian(math.Float64bits(float64(v)), 8)
+	case float64:
+		annotation.AnnotationType = zipkincore.AnnotationType_DOUBLE
+		annotation.Value = bigEndian(math.Float64bits(v), 8)
+	default:
+		annotation.AnnotationType = zipkincore.AnnotationType_STRING
+		annotation.Value = []byte(fmt.Sprint(v))
+	}
+	return annotation
+}
+
+func bigEndian(value uint64, size int) []byte {
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(bytes, value)
+	return bytes[8-size:]
+}
+
+// AnnotateAddress records the remote endpoint of the span under
+// zipkincore.SERVER_ADDR, zipkincore.CLIENT_ADDR or MessageAddr. An address
+// which is not an ipv4 address, e.g. a host name, is reported as the service
+// name only.
+func (s *Span) AnnotateAddress(key string, serviceName string, ip string, port int16) {
+	if !s.sampled {
+		return
+	}
+	ipv4, err := parseIPv4(ip)
+	if err != nil {
+		ipv4 = 0
+	}
+	s.addBinaryAnnotation(&zipkincore.BinaryAnnotation{
+		Key:            key,
+		Value:          []byte{1},
+		AnnotationType: zipkincore.AnnotationType_BOOL,
+		Host:           &zipkincore.Endpoint{ServiceName: serviceName, Ipv4: ipv4, Port: port},
+	})
+}
+
+func (s *Span) addBinaryAnnotation(annotation *zipkincore.BinaryAnnotation) {
+	s.Lock()
+	s.span.BinaryAnnotations = append(s.span.BinaryAnnotations, annotation)
+	s.Unlock()
+}
+
+func (s *Span) logger() Logger {
+	if s.tracer == nil {
+		return defaultLogger{}
+	}
+	return s.tracer.logger
+}
+
+func (t *Tracer) nowMicrosecond() *int64 {
+	now := t.clock().UnixNano() / 1000
+	return &now
 }
@@ -0,0 +1,92 @@
+package zipkin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+type recordingLogger struct {
+	warnings []string
+}
+
+func (rl *recordingLogger) Debugf(format string, args ...interface{}) {}
+func (rl *recordingLogger) Infof(format string, args ...interface{})  {}
+func (rl *recordingLogger) Warningf(format string, args ...interface{}) {
+	rl.warnings = append(rl.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestEndpointEncoding(t *testing.T) {
+	tracer := NewTracerWithOptions("service", WithEndpoint("10.0.0.1", 8080))
+	if tracer.endpoint.Ipv4 != 0x0a000001 || tracer.endpoint.Port != 8080 || tracer.endpoint.ServiceName != "service" {
+		t.Errorf("Unexpected endpoint %v", tracer.endpoint)
+	}
+}
+
+func TestEndpointResolvedAfterOptions(t *testing.T) {
+	logger := &recordingLogger{}
+	// the logger given after the endpoint receives the warning
+	tracer := NewTracerWithOptions("service", WithEndpoint("not an ip", 1), WithLogger(logger))
+	if tracer.endpoint.Ipv4 != localhost {
+		t.Errorf("Expected localhost for an invalid address, got %x", tracer.endpoint.Ipv4)
+	}
+	if len(logger.warnings) != 1 {
+		t.Errorf("Expected one warning through the configured logger, got %v", logger.warnings)
+	}
+}
+
+func TestRootSpanID(t *testing.T) {
+	ids := []int64{1, 2}
+	tracer := NewTracerWithOptions("service", WithEndpoint("127.0.0.1", 0), WithIDGenerator(func() int64 {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}))
+	span := tracer.NewSpan("root")
+	if span.TraceID() != 1 || span.ID() != 2 || span.ParentID() != nil {
+		t.Errorf("Expected trace 1 and span 2 without parent, got %d, %d, %v", span.TraceID(), span.ID(), span.ParentID())
+	}
+}
+
+func TestBinaryAnnotationUnsignedIntegers(t *testing.T) {
+	for _, value := range []interface{}{uint(42), uint64(42)} {
+		annotation := NewBinaryAnnotation("key", value, nil)
+		if annotation.AnnotationType != zipkincore.AnnotationType_I64 || binary.BigEndian.Uint64(annotation.Value) != 42 {
+			t.Errorf("%T annotation is %s %v, want I64 42", value, annotation.AnnotationType, annotation.Value)
+		}
+	}
+	annotation := NewBinaryAnnotation("key", uint64(math.MaxUint64), nil)
+	if annotation.AnnotationType != zipkincore.AnnotationType_STRING || string(annotation.Value) != "18446744073709551615" {
+		t.Errorf("Out of range uint64 annotation is %s %q", annotation.AnnotationType, annotation.Value)
+	}
+}
+
+type collectedSpans []*zipkincore.Span
+
+func (cs *collectedSpans) Collect(span *zipkincore.Span) error {
+	*cs = append(*cs, span)
+	return nil
+}
+
+func TestCollectHandsOverSnapshot(t *testing.T) {
+	collected := &collectedSpans{}
+	tracer := NewTracerWithOptions("service", WithCollector(collected), WithEndpoint("127.0.0.1", 0))
+
+	span := tracer.NewSpan("request")
+	span.ServerReceiveAndCollect()
+	span.Tag("key", "value")
+	span.ServerSendAndCollect()
+
+	first, second := (*collected)[0], (*collected)[1]
+	if len(first.Annotations) != 1 || len(first.BinaryAnnotations) != 0 {
+		t.Errorf("Collected span changed after Collect: %d annotations, %d binary annotations",
+			len(first.Annotations), len(first.BinaryAnnotations))
+	}
+	if len(second.Annotations) != 2 || len(second.BinaryAnnotations) != 1 {
+		t.Errorf("Second collected span has %d annotations, %d binary annotations, expected 2 and 1",
+			len(second.Annotations), len(second.BinaryAnnotations))
+	}
+}
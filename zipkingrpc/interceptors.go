@@ -0,0 +1,199 @@
+// Package zipkingrpc traces gRPC clients and servers with go-zipkin. Trace
+// context is propagated in B3 metadata, spans are named after the full
+// method and tagged with the status code and errors.
+package zipkingrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const statusCodeKey = "grpc.status_code"
+
+// UnaryServerInterceptor records a server span around each unary call.
+func UnaryServerInterceptor(tracer *zipkin.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		span := startServerSpan(ctx, tracer, info.FullMethod)
+		resp, err := handler(zipkin.NewContext(ctx, span), req)
+		finish(span, err)
+		span.ServerSendAndCollect()
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records a server span around each streaming call.
+func StreamServerInterceptor(tracer *zipkin.Tracer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		span := startServerSpan(stream.Context(), tracer, info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: zipkin.NewContext(stream.Context(), span)})
+		finish(span, err)
+		span.ServerSendAndCollect()
+		return err
+	}
+}
+
+// UnaryClientInterceptor records a client span around each unary call, a
+// child of the span in the call context if there is one.
+func UnaryClientInterceptor(tracer *zipkin.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		span, ctx := startClientSpan(ctx, tracer, method, cc)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finish(span, err)
+		span.ClientReceiveAndCollect()
+		return err
+	}
+}
+
+// StreamClientInterceptor records a client span for each streaming call. The
+// span ends once the stream fails or the server finished it, as seen by
+// RecvMsg returning an error or io.EOF, once the single response of a client
+// streaming call is received, or when the call context is done.
+func StreamClientInterceptor(tracer *zipkin.Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		span, ctx := startClientSpan(ctx, tracer, method, cc)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finish(span, err)
+			span.ClientReceiveAndCollect()
+			return nil, err
+		}
+		traced := &clientStream{ClientStream: stream, span: span, serverStreams: desc.ServerStreams,
+			done: make(chan struct{})}
+		go traced.finishOnDone(ctx)
+		return traced, nil
+	}
+}
+
+func startServerSpan(ctx context.Context, tracer *zipkin.Tracer, method string) *zipkin.Span {
+	md, _ := metadata.FromIncomingContext(ctx)
+	span := tracer.NewSpanFromCarrier(method, carrierFromMetadata(md))
+	span.ServerReceive()
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, port, ok := splitAddress(p.Addr.String()); ok {
+			span.AnnotateAddress(zipkincore.CLIENT_ADDR, "", host, port)
+		}
+	}
+	return span
+}
+
+func startClientSpan(ctx context.Context, tracer *zipkin.Tracer, method string,
+	cc *grpc.ClientConn) (*zipkin.Span, context.Context) {
+	var span *zipkin.Span
+	if parent := zipkin.SpanFromContext(ctx); parent != nil {
+		span = parent.NewChild(method)
+	} else {
+		span = tracer.NewSpan(method)
+	}
+
+	carrier := make(map[string]string)
+	span.Inject(carrier)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for key, value := range carrier {
+		md.Set(key, value)
+	}
+	if cc != nil {
+		if host, port, ok := splitAddress(targetAddress(cc.Target())); ok {
+			span.AnnotateAddress(zipkincore.SERVER_ADDR, host, host, port)
+		}
+	}
+	span.ClientSend()
+	return span, metadata.NewOutgoingContext(zipkin.NewContext(ctx, span), md)
+}
+
+// finish tags the outcome of the call.
+func finish(span *zipkin.Span, err error) {
+	span.Tag(statusCodeKey, status.Code(err).String())
+	if err != nil {
+		span.Tag("error", status.Convert(err).Message())
+	}
+}
+
+func carrierFromMetadata(md metadata.MD) map[string]string {
+	carrier := make(map[string]string, len(md))
+	for key, values := range md {
+		if len(values) > 0 {
+			carrier[key] = values[0]
+		}
+	}
+	return carrier
+}
+
+// targetAddress strips the resolver scheme from targets like dns:///host:port.
+func targetAddress(target string) string {
+	if i := strings.Index(target, ":///"); i >= 0 {
+		return target[i+4:]
+	}
+	return target
+}
+
+func splitAddress(address string) (string, int16, bool) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, false
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, int16(portNumber), true
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	span          *zipkin.Span
+	serverStreams bool
+	finished      sync.Once
+	done          chan struct{}
+}
+
+func (cs *clientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err == io.EOF || (err == nil && !cs.serverStreams) {
+		cs.finish(nil)
+	} else if err != nil {
+		cs.finish(err)
+	}
+	return err
+}
+
+// finishOnDone ends the span of a stream abandoned by cancelling its context.
+func (cs *clientStream) finishOnDone(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		cs.finish(status.FromContextError(ctx.Err()).Err())
+	case <-cs.done:
+	}
+}
+
+func (cs *clientStream) finish(err error) {
+	cs.finished.Do(func() {
+		close(cs.done)
+		finish(cs.span, err)
+		cs.span.ClientReceiveAndCollect()
+	})
+}
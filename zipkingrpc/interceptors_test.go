@@ -0,0 +1,161 @@
+package zipkingrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/zipkintest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// testService echoes a unary call, counts the messages of a client stream and
+// streams messages to the client until it cancels.
+var testService = grpc.ServiceDesc{
+	ServiceName: "test.Test",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+			interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(wrapperspb.StringValue)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			echo := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Test/Echo"}, echo)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Count",
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			var count int64
+			for {
+				if err := stream.RecvMsg(new(wrapperspb.StringValue)); err == io.EOF {
+					return stream.SendMsg(wrapperspb.Int64(count))
+				} else if err != nil {
+					return err
+				}
+				count++
+			}
+		},
+	}, {
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				if err := stream.SendMsg(wrapperspb.String("tick")); err != nil {
+					return err
+				}
+				select {
+				case <-stream.Context().Done():
+					return stream.Context().Err()
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		},
+	}},
+}
+
+func newTestConn(t *testing.T) (*grpc.ClientConn, *zipkintest.RecordingCollector, *zipkintest.RecordingCollector) {
+	serverTracer, serverSpans := zipkintest.NewTracer("server")
+	clientTracer, clientSpans := zipkintest.NewTracer("client")
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor(serverTracer)),
+		grpc.StreamInterceptor(StreamServerInterceptor(serverTracer)))
+	server.RegisterService(&testService, struct{}{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(clientTracer)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(clientTracer)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, clientSpans, serverSpans
+}
+
+func TestUnaryCall(t *testing.T) {
+	conn, clientSpans, serverSpans := newTestConn(t)
+
+	reply := new(wrapperspb.StringValue)
+	if err := conn.Invoke(context.Background(), "/test.Test/Echo", wrapperspb.String("hello"), reply); err != nil {
+		t.Fatal(err)
+	}
+
+	client := clientSpans.RequireSpans(t, 1, time.Second)[0]
+	server := serverSpans.RequireSpans(t, 1, time.Second)[0]
+	zipkintest.AssertAnnotations(t, client, "cs", "cr")
+	zipkintest.AssertAnnotations(t, server, "sr", "ss")
+	zipkintest.AssertBinaryAnnotation(t, client, statusCodeKey, "OK")
+	if server.TraceID != client.TraceID || server.ID != client.ID {
+		t.Errorf("Server span %d/%d does not join client span %d/%d", server.TraceID, server.ID,
+			client.TraceID, client.ID)
+	}
+}
+
+func TestClientStreamEndsAfterResponse(t *testing.T) {
+	conn, clientSpans, _ := newTestConn(t)
+
+	stream, err := conn.NewStream(context.Background(), &testService.Streams[0], "/test.Test/Count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(wrapperspb.String("message")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	reply := new(wrapperspb.Int64Value)
+	if err := stream.RecvMsg(reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Value != 3 {
+		t.Errorf("Server counted %d messages, want 3", reply.Value)
+	}
+
+	// the generated CloseAndRecv stops after the response, no RecvMsg returns io.EOF
+	client := clientSpans.RequireSpans(t, 1, time.Second)[0]
+	zipkintest.AssertAnnotations(t, client, "cs", "cr")
+	zipkintest.AssertBinaryAnnotation(t, client, statusCodeKey, "OK")
+}
+
+func TestServerStreamEndsOnCancel(t *testing.T) {
+	conn, clientSpans, serverSpans := newTestConn(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &testService.Streams[1], "/test.Test/Watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(new(wrapperspb.StringValue)); err != nil {
+		t.Fatal(err)
+	}
+	if spans := clientSpans.Spans(); len(spans) != 0 {
+		t.Fatalf("Client span ended while the server is streaming")
+	}
+	cancel()
+
+	client := clientSpans.RequireSpans(t, 1, time.Second)[0]
+	zipkintest.AssertAnnotations(t, client, "cs", "cr")
+	zipkintest.AssertBinaryAnnotation(t, client, statusCodeKey, "Canceled")
+	serverSpans.RequireSpans(t, 1, time.Second)
+}
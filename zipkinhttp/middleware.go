@@ -0,0 +1,142 @@
+// Package zipkinhttp traces net/http servers and clients with go-zipkin.
+package zipkinhttp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// SpanNameFunc names the span of a request.
+type SpanNameFunc func(r *http.Request) string
+
+// MethodSpanName names spans after the lower case HTTP method, as Zipkin does.
+func MethodSpanName(r *http.Request) string {
+	return strings.ToLower(r.Method)
+}
+
+type MiddlewareOption func(*middleware)
+
+// SpanName sets the naming function, MethodSpanName by default.
+func SpanName(name SpanNameFunc) MiddlewareOption {
+	return func(m *middleware) {
+		m.spanName = name
+	}
+}
+
+type middleware struct {
+	tracer   *zipkin.Tracer
+	handler  http.Handler
+	spanName SpanNameFunc
+}
+
+// Middleware traces the requests served by handler. It joins the trace
+// propagated in the request headers or starts a new one, records sr and ss
+// around the handler and tags the method, path, status code and response
+// size. The span is available to the handler through
+// zipkin.SpanFromContext(r.Context()).
+func Middleware(tracer *zipkin.Tracer, handler http.Handler, options ...MiddlewareOption) http.Handler {
+	m := &middleware{tracer: tracer, handler: handler, spanName: MethodSpanName}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	span := m.tracer.NewSpanFromCarrier(m.spanName(r), r.Header)
+	span.ServerReceive()
+	span.Tag(zipkincore.HTTP_METHOD, r.Method)
+	span.Tag(zipkincore.HTTP_PATH, r.URL.Path)
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			span.Tag(zipkincore.HTTP_STATUS_CODE, strconv.Itoa(http.StatusInternalServerError))
+			span.Tag("error", fmt.Sprint(recovered))
+			span.ServerSendAndCollect()
+			panic(recovered)
+		}
+		span.Tag(zipkincore.HTTP_STATUS_CODE, strconv.Itoa(recorder.status))
+		span.Tag(zipkincore.HTTP_RESPONSE_SIZE, strconv.FormatInt(recorder.size, 10))
+		if recorder.status >= 500 {
+			span.Tag("error", http.StatusText(recorder.status))
+		}
+		span.ServerSendAndCollect()
+	}()
+	m.handler.ServeHTTP(recorder, r.WithContext(zipkin.NewContext(r.Context(), span)))
+}
+
+// responseRecorder remembers the status code and the number of body bytes
+// written. It always implements http.Flusher, http.Hijacker, http.Pusher and
+// io.ReaderFrom, forwarding to the wrapped ResponseWriter if that supports
+// them: Flush then does nothing, Hijack fails and Push returns
+// http.ErrNotSupported. Unwrap gives http.ResponseController access to the
+// wrapped ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(data)
+	rr.size += int64(n)
+	return n, err
+}
+
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rr *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+func (rr *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := rr.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (rr *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rr.wroteHeader = true
+	var n int64
+	var err error
+	if readerFrom, ok := rr.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(src)
+	} else {
+		n, err = io.Copy(rr.ResponseWriter, src)
+	}
+	rr.size += n
+	return n, err
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
@@ -0,0 +1,104 @@
+package zipkinhttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/go-zipkin/zipkintest"
+)
+
+func TestMiddlewareRecordsServerSpan(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("server")
+	handler := Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if zipkin.SpanFromContext(r.Context()) == nil {
+			t.Error("Handler has no span in its request context")
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("POST", "/orders?id=1", nil))
+
+	span := recorder.RequireSpan(t, "post")
+	zipkintest.AssertRoot(t, span)
+	zipkintest.AssertAnnotations(t, span, zipkincore.SERVER_RECV, zipkincore.SERVER_SEND)
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_METHOD, "POST")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_PATH, "/orders")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_STATUS_CODE, "201")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_RESPONSE_SIZE, "5")
+	for _, annotation := range span.BinaryAnnotations {
+		if annotation.Key == "error" {
+			t.Errorf("Successful request tagged with error %q", annotation.Value)
+		}
+	}
+}
+
+func TestMiddlewareJoinsB3Trace(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("server")
+	handler := Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-B3-TraceId", "000000000000000a")
+	request.Header.Set("X-B3-SpanId", "000000000000000b")
+	request.Header.Set("X-B3-ParentSpanId", "000000000000000c")
+	request.Header.Set("X-B3-Sampled", "1")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	span := recorder.RequireSpan(t, "get")
+	if span.TraceID != 10 || span.ID != 11 || span.ParentID == nil || *span.ParentID != 12 {
+		t.Errorf("Span %x/%x/%v does not join the propagated span a/b/c", span.TraceID, span.ID, span.ParentID)
+	}
+}
+
+func TestMiddlewareTagsServerErrors(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("server")
+	handler := Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	span := recorder.RequireSpan(t, "get")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_STATUS_CODE, "503")
+	zipkintest.AssertBinaryAnnotation(t, span, "error", http.StatusText(http.StatusServiceUnavailable))
+}
+
+func TestMiddlewareForwardsOptionalInterfaces(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("server")
+	handler := Middleware(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("ResponseWriter is no http.Flusher")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("ResponseWriter is no http.Hijacker")
+		}
+		if err := w.(http.Pusher).Push("/style.css", nil); err != http.ErrNotSupported {
+			t.Errorf("Push over HTTP/1.1 returned %v, expected http.ErrNotSupported", err)
+		}
+		if _, err := w.(io.ReaderFrom).ReadFrom(bytes.NewReader([]byte("body"))); err != nil {
+			t.Error(err)
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "body" {
+		t.Errorf("Received body %q, expected the one written with ReadFrom", body)
+	}
+	zipkintest.AssertBinaryAnnotation(t, recorder.RequireSpan(t, "get"), zipkincore.HTTP_RESPONSE_SIZE, "4")
+}
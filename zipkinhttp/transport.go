@@ -0,0 +1,85 @@
+package zipkinhttp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// Transport traces outgoing requests. Each request gets a client span, a
+// child of the span in the request context if there is one, which records
+// cs and cr around the round trip, is propagated in B3 headers and tags the
+// url, method, status code and errors along with the server address.
+// The span ends once the response headers are received.
+type Transport struct {
+	Tracer *zipkin.Tracer
+	// Base performs the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// SpanName names the spans, MethodSpanName if nil.
+	SpanName SpanNameFunc
+}
+
+func NewTransport(tracer *zipkin.Tracer, base http.RoundTripper) *Transport {
+	return &Transport{Tracer: tracer, Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	spanName := t.SpanName
+	if spanName == nil {
+		spanName = MethodSpanName
+	}
+	var span *zipkin.Span
+	if parent := zipkin.SpanFromContext(req.Context()); parent != nil {
+		span = parent.NewChild(spanName(req))
+	} else {
+		span = t.Tracer.NewSpan(spanName(req))
+	}
+
+	// a RoundTripper must not modify the request, inject into a copy
+	traced := new(http.Request)
+	*traced = *req
+	traced.Header = make(http.Header, len(req.Header)+4)
+	for key, values := range req.Header {
+		traced.Header[key] = values
+	}
+	span.Inject(traced.Header)
+
+	// keep credentials in the url out of the trace
+	tagged := *req.URL
+	tagged.User = nil
+	span.Tag(zipkincore.HTTP_URL, tagged.String())
+	span.Tag(zipkincore.HTTP_METHOD, req.Method)
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	portNumber, _ := strconv.ParseUint(port, 10, 16)
+	serviceName := host
+	if net.ParseIP(host) != nil {
+		serviceName = ""
+	}
+	span.AnnotateAddress(zipkincore.SERVER_ADDR, serviceName, host, int16(portNumber))
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	span.ClientSend()
+	resp, err := base.RoundTrip(traced)
+	if err != nil {
+		span.Tag("error", err.Error())
+	} else {
+		span.Tag(zipkincore.HTTP_STATUS_CODE, strconv.Itoa(resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			span.Tag("error", resp.Status)
+		}
+	}
+	span.ClientReceiveAndCollect()
+	return resp, err
+}
@@ -0,0 +1,114 @@
+package zipkinhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/go-zipkin/zipkintest"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func parseB3ID(t *testing.T, header http.Header, key string) int64 {
+	id, err := strconv.ParseUint(header.Get(key), 16, 64)
+	if err != nil {
+		t.Fatalf("Invalid %s header %q", key, header.Get(key))
+	}
+	return int64(id)
+}
+
+func TestTransportRecordsClientSpan(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+	tracer, recorder := zipkintest.NewTracer("client")
+	parent := tracer.NewSpan("parent")
+
+	req, err := http.NewRequest("GET", server.URL+"/orders", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(zipkin.NewContext(req.Context(), parent))
+	resp, err := NewTransport(tracer, nil).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	span := recorder.RequireSpan(t, "get")
+	zipkintest.AssertAnnotations(t, span, zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV)
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_METHOD, "GET")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_STATUS_CODE, "200")
+	if span.TraceID != parent.TraceID() || span.ParentID == nil || *span.ParentID != parent.ID() {
+		t.Errorf("Span %x/%v is no child of the context span %x/%x", span.TraceID, span.ParentID,
+			parent.TraceID(), parent.ID())
+	}
+	traceID, spanID := parseB3ID(t, received, "X-B3-TraceId"), parseB3ID(t, received, "X-B3-SpanId")
+	if traceID != span.TraceID || spanID != span.ID {
+		t.Errorf("Request propagated %x/%x, expected the client span %x/%x", traceID, spanID, span.TraceID, span.ID)
+	}
+	if req.Header.Get("X-B3-TraceId") != "" {
+		t.Error("Transport modified the request headers")
+	}
+}
+
+func TestTransportTagsErrors(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("client")
+
+	failing := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	req, _ := http.NewRequest("GET", "http://orders:8080/", nil)
+	if _, err := NewTransport(tracer, failing).RoundTrip(req); err == nil {
+		t.Fatal("Failed round trip returned no error")
+	}
+	span := recorder.RequireSpan(t, "get")
+	zipkintest.AssertAnnotations(t, span, zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV)
+	zipkintest.AssertBinaryAnnotation(t, span, "error", "connection refused")
+
+	recorder.Reset()
+	unavailable := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 503, Status: "503 Service Unavailable", Body: http.NoBody}, nil
+	})
+	if _, err := NewTransport(tracer, unavailable).RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	span = recorder.RequireSpan(t, "get")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_STATUS_CODE, "503")
+	zipkintest.AssertBinaryAnnotation(t, span, "error", "503 Service Unavailable")
+}
+
+func TestTransportStripsCredentialsFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tracer, recorder := zipkintest.NewTracer("client")
+
+	url := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/orders"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewTransport(tracer, nil).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	span := recorder.RequireSpan(t, "get")
+	zipkintest.AssertBinaryAnnotation(t, span, zipkincore.HTTP_URL, server.URL+"/orders")
+	if req.URL.User == nil {
+		t.Error("Transport modified the request url")
+	}
+}
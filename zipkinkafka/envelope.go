@@ -0,0 +1,110 @@
+package zipkinkafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/elodina/go-zipkin"
+)
+
+// An envelope is the magic bytes, a flags byte, the trace and span ids as big
+// endian int64s, the parent span id if flagged, a big endian CRC-32 (IEEE) of
+// all of the above and the message payload. The checksum keeps payloads which
+// happen to start with the magic bytes from being taken for an envelope: they
+// fail it and Receive delivers them unchanged.
+var envelopeMagic = []byte{0xff, 'Z', 'K', 1}
+
+const (
+	flagSampledKnown = 1 << iota
+	flagSampled
+	flagDebug
+	flagIDs
+	flagParent
+
+	knownFlags = flagParent<<1 - 1
+)
+
+var (
+	ErrTruncatedEnvelope = errors.New("Truncated trace context envelope")
+	ErrCorruptEnvelope   = errors.New("Trace context envelope checksum mismatch")
+)
+
+// Wrap prepends the trace context to the message payload.
+func Wrap(context zipkin.SpanContext, payload []byte) []byte {
+	size := len(envelopeMagic) + 1 + 16 + 4 + len(payload)
+	if context.ParentID != nil {
+		size += 8
+	}
+	envelope := make([]byte, 0, size)
+	envelope = append(envelope, envelopeMagic...)
+
+	var flags byte
+	if context.Sampled != nil {
+		flags |= flagSampledKnown
+		if *context.Sampled {
+			flags |= flagSampled
+		}
+	}
+	if context.Debug {
+		flags |= flagDebug
+	}
+	if context.TraceID != 0 || context.SpanID != 0 {
+		flags |= flagIDs
+	}
+	if context.ParentID != nil {
+		flags |= flagParent
+	}
+	envelope = append(envelope, flags)
+
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], uint64(context.TraceID))
+	envelope = append(envelope, id[:]...)
+	binary.BigEndian.PutUint64(id[:], uint64(context.SpanID))
+	envelope = append(envelope, id[:]...)
+	if context.ParentID != nil {
+		binary.BigEndian.PutUint64(id[:], uint64(*context.ParentID))
+		envelope = append(envelope, id[:]...)
+	}
+	binary.BigEndian.PutUint32(id[:4], crc32.ChecksumIEEE(envelope))
+	envelope = append(envelope, id[:4]...)
+	return append(envelope, payload...)
+}
+
+// Unwrap splits an envelope into trace context and payload. Data without
+// envelope is returned as the payload with a nil context, so producers can be
+// instrumented before their consumers. Data with the magic bytes but a short
+// or corrupt header fails with ErrTruncatedEnvelope or ErrCorruptEnvelope.
+func Unwrap(data []byte) (*zipkin.SpanContext, []byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return nil, data, nil
+	}
+	headerSize := len(envelopeMagic) + 1 + 16
+	if len(data) > len(envelopeMagic) && data[len(envelopeMagic)]&flagParent != 0 {
+		headerSize += 8
+	}
+	if len(data) < headerSize+4 {
+		return nil, nil, ErrTruncatedEnvelope
+	}
+	flags := data[len(envelopeMagic)]
+	if flags&^knownFlags != 0 || crc32.ChecksumIEEE(data[:headerSize]) != binary.BigEndian.Uint32(data[headerSize:]) {
+		return nil, nil, ErrCorruptEnvelope
+	}
+	payload := data[headerSize+4:]
+	data = data[len(envelopeMagic):headerSize]
+	context := &zipkin.SpanContext{Debug: flags&flagDebug != 0}
+	if flags&flagSampledKnown != 0 {
+		sampled := flags&flagSampled != 0
+		context.Sampled = &sampled
+	}
+	if flags&flagIDs != 0 {
+		context.TraceID = int64(binary.BigEndian.Uint64(data[1:]))
+		context.SpanID = int64(binary.BigEndian.Uint64(data[9:]))
+	}
+	if flags&flagParent != 0 {
+		parentID := int64(binary.BigEndian.Uint64(data[17:]))
+		context.ParentID = &parentID
+	}
+	return context, payload, nil
+}
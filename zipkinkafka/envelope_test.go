@@ -0,0 +1,52 @@
+package zipkinkafka
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	sampled := true
+	parentID := int64(3)
+	for _, context := range []zipkin.SpanContext{
+		{},
+		{TraceID: 1, SpanID: 2, Sampled: &sampled},
+		{TraceID: 1, SpanID: 2, ParentID: &parentID, Sampled: &sampled, Debug: true},
+	} {
+		unwrapped, payload, err := Unwrap(Wrap(context, []byte("payload")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*unwrapped, context) {
+			t.Errorf("Unwrapped %+v, want %+v", *unwrapped, context)
+		}
+		if string(payload) != "payload" {
+			t.Errorf("Unwrapped payload %q", payload)
+		}
+	}
+}
+
+func TestUnwrapRejectsCorruptEnvelopes(t *testing.T) {
+	raw := append(append([]byte{}, envelopeMagic...), bytes.Repeat([]byte{0}, 32)...)
+	if _, _, err := Unwrap(raw); err != ErrCorruptEnvelope {
+		t.Errorf("Unwrapped payload starting with the magic bytes: %v", err)
+	}
+
+	envelope := Wrap(zipkin.SpanContext{TraceID: 1, SpanID: 2}, []byte("payload"))
+	envelope[len(envelopeMagic)+1] ^= 1
+	if _, _, err := Unwrap(envelope); err != ErrCorruptEnvelope {
+		t.Errorf("Unwrapped envelope with a flipped id bit: %v", err)
+	}
+
+	if _, _, err := Unwrap(envelope[:len(envelopeMagic)+10]); err != ErrTruncatedEnvelope {
+		t.Errorf("Unwrapped truncated envelope: %v", err)
+	}
+
+	payload := []byte("no envelope")
+	if context, unwrapped, err := Unwrap(payload); context != nil || err != nil || !bytes.Equal(unwrapped, payload) {
+		t.Errorf("Unwrap(%q) = %v, %q, %v", payload, context, unwrapped, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package zipkinkafka traces messages sent and received with siesta. The
+// producer records an ms span named after the topic and prepends its trace
+// context to the message in an envelope, the consumer strips the envelope
+// and records an mr span as child of the producer's span.
+package zipkinkafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/siesta"
+	"github.com/elodina/siesta-producer"
+	"github.com/yanzay/log"
+)
+
+const (
+	kafkaServiceName = "kafka"
+	topicKey         = "kafka.topic"
+	partitionKey     = "kafka.partition"
+)
+
+// Producer sends records with []byte values wrapped in a trace context envelope.
+type Producer struct {
+	producer zipkin.RecordProducer
+	tracer   *zipkin.Tracer
+}
+
+// NewProducer wraps kafkaProducer, a *producer.KafkaProducer for example.
+func NewProducer(tracer *zipkin.Tracer, kafkaProducer zipkin.RecordProducer) *Producer {
+	return &Producer{producer: kafkaProducer, tracer: tracer}
+}
+
+// Send records a producer span, a child of the span in ctx if there is one,
+// and sends a copy of the record with the span's context in the envelope.
+func (p *Producer) Send(ctx context.Context, record *producer.ProducerRecord) (<-chan *producer.RecordMetadata, error) {
+	value, ok := record.Value.([]byte)
+	if !ok {
+		return nil, errors.New("Traced Kafka records need []byte values")
+	}
+	var span *zipkin.Span
+	if parent := zipkin.SpanFromContext(ctx); parent != nil {
+		span = parent.NewChild(record.Topic)
+	} else {
+		span = p.tracer.NewSpan(record.Topic)
+	}
+	span.Tag(topicKey, record.Topic)
+	span.AnnotateAddress(zipkin.MessageAddr, kafkaServiceName, "", 0)
+	span.Annotate(zipkin.MessageSend)
+
+	traced := *record
+	traced.Value = Wrap(span.Context(), value)
+	metadata := p.producer.Send(&traced)
+	span.Collect()
+	return metadata, nil
+}
+
+// Message is a consumed message with the envelope stripped from its Value.
+type Message struct {
+	*siesta.MessageAndMetadata
+	// Span is the consumer span, to be used as parent of the processing spans.
+	Span *zipkin.Span
+}
+
+// Context returns a copy of ctx carrying the message's span.
+func (m *Message) Context(ctx context.Context) context.Context {
+	return zipkin.NewContext(ctx, m.Span)
+}
+
+// Consumer fetches messages, from a siesta.Connector for example, and
+// receives them with Receive.
+type Consumer struct {
+	source zipkin.MessageSource
+	tracer *zipkin.Tracer
+}
+
+func NewConsumer(tracer *zipkin.Tracer, source zipkin.MessageSource) *Consumer {
+	return &Consumer{source: source, tracer: tracer}
+}
+
+func (c *Consumer) Consume(topic string, partition int32, offset int64) ([]*Message, error) {
+	fetched, err := c.source.Consume(topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, len(fetched))
+	for i, message := range fetched {
+		messages[i] = Receive(c.tracer, message)
+	}
+	return messages, nil
+}
+
+// Receive records a consumer span for the message, a child of the producer
+// span in the envelope or a new trace if there is none.
+func Receive(tracer *zipkin.Tracer, message *siesta.MessageAndMetadata) *Message {
+	traceContext, payload, err := Unwrap(message.Value)
+	if err != nil {
+		log.Warningf("[Zipkin] Unable to read trace context of message at %s/%d offset %d: %s", message.Topic,
+			message.Partition, message.Offset, err)
+		traceContext, payload = nil, message.Value
+	}
+	var span *zipkin.Span
+	if traceContext != nil {
+		span = tracer.NewChildSpan(message.Topic, *traceContext)
+	} else {
+		span = tracer.NewSpan(message.Topic)
+	}
+	span.Tag(topicKey, message.Topic)
+	span.Tag(partitionKey, strconv.Itoa(int(message.Partition)))
+	span.AnnotateAddress(zipkin.MessageAddr, kafkaServiceName, "", 0)
+	span.Annotate(zipkin.MessageRecv)
+	span.Collect()
+
+	received := *message
+	received.Value = payload
+	return &Message{MessageAndMetadata: &received, Span: span}
+}
@@ -0,0 +1,87 @@
+package zipkinkafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/zipkintest"
+	"github.com/elodina/siesta"
+	"github.com/elodina/siesta-producer"
+)
+
+// fakeProducer appends the records sent to a zipkintest.MessageSource.
+type fakeProducer struct {
+	lock   sync.Mutex
+	source *zipkintest.MessageSource
+}
+
+func (fp *fakeProducer) Send(record *producer.ProducerRecord) <-chan *producer.RecordMetadata {
+	fp.lock.Lock()
+	offset := fp.source.Append(record.Topic, record.Partition, record.Value.([]byte))
+	fp.lock.Unlock()
+	metadata := make(chan *producer.RecordMetadata, 1)
+	metadata <- &producer.RecordMetadata{Topic: record.Topic, Partition: record.Partition, Offset: offset}
+	return metadata
+}
+
+func TestSendAndReceive(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("service")
+	source := zipkintest.NewMessageSource()
+	parent := tracer.NewSpan("request")
+
+	record := &producer.ProducerRecord{Topic: "orders", Value: []byte("payload")}
+	tracedProducer := NewProducer(tracer, &fakeProducer{source: source})
+	metadata, err := tracedProducer.Send(zipkin.NewContext(context.Background(), parent), record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := <-metadata; m.Error != nil {
+		t.Fatal(m.Error)
+	}
+	if string(record.Value.([]byte)) != "payload" {
+		t.Error("Send modified the record")
+	}
+
+	messages, err := NewConsumer(tracer, source).Consume("orders", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Value) != "payload" {
+		t.Fatalf("Consumed %v, expected the payload without envelope", messages)
+	}
+
+	spans := recorder.RequireSpans(t, 2, time.Second)
+	send, receive := spans[0], spans[1]
+	zipkintest.AssertAnnotations(t, send, zipkin.MessageSend)
+	zipkintest.AssertAnnotations(t, receive, zipkin.MessageRecv)
+	zipkintest.AssertBinaryAnnotation(t, send, topicKey, "orders")
+	zipkintest.AssertBinaryAnnotation(t, receive, partitionKey, "0")
+	if send.TraceID != parent.TraceID() || send.ParentID == nil || *send.ParentID != parent.ID() {
+		t.Errorf("Producer span is no child of the context span")
+	}
+	zipkintest.AssertChildOf(t, send, receive)
+	if messages[0].Span.ID() != receive.ID {
+		t.Error("Message does not carry the consumer span")
+	}
+}
+
+func TestReceiveWithoutEnvelope(t *testing.T) {
+	tracer, recorder := zipkintest.NewTracer("service")
+
+	message := Receive(tracer, &siesta.MessageAndMetadata{Topic: "orders", Value: []byte("plain")})
+
+	if string(message.Value) != "plain" {
+		t.Errorf("Received %q, expected the plain value", message.Value)
+	}
+	span := recorder.RequireSpan(t, "orders")
+	zipkintest.AssertRoot(t, span)
+	zipkintest.AssertAnnotations(t, span, zipkin.MessageRecv)
+	for _, annotation := range span.BinaryAnnotations {
+		if annotation.Key == zipkin.MessageAddr && annotation.Host.ServiceName != kafkaServiceName {
+			t.Errorf("Message address names service %q", annotation.Host.ServiceName)
+		}
+	}
+}
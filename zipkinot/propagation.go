@@ -0,0 +1,233 @@
+package zipkinot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/elodina/go-zipkin"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// baggagePrefix is prepended to the keys of baggage items in TextMap and
+// HTTPHeaders carriers.
+const baggagePrefix = "ot-baggage-"
+
+// maxBaggageItemSize bounds the keys and values read from Binary carriers.
+const maxBaggageItemSize = 64 * 1024
+
+// flags of the Binary format
+const (
+	flagSampledSet = 1 << iota
+	flagSampled
+	flagDebug
+	flagParent
+)
+
+// Inject writes the span context to TextMap and HTTPHeaders carriers with
+// the propagators of the zipkin.Tracer, B3 headers by default, and to
+// io.Writer carriers in the Binary format.
+func (t *Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	context, ok := sm.(spanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+	switch format {
+	case opentracing.TextMap, opentracing.HTTPHeaders:
+		writer, ok := carrier.(opentracing.TextMapWriter)
+		if !ok {
+			return opentracing.ErrInvalidCarrier
+		}
+		headers := make(map[string]string)
+		if err := t.tracer.Inject(context.SpanContext, headers); err != nil {
+			return err
+		}
+		for key, value := range headers {
+			writer.Set(key, value)
+		}
+		for key, value := range context.baggage {
+			if format == opentracing.HTTPHeaders {
+				value = url.QueryEscape(value)
+			}
+			writer.Set(baggagePrefix+key, value)
+		}
+		return nil
+	case opentracing.Binary:
+		writer, ok := carrier.(io.Writer)
+		if !ok {
+			return opentracing.ErrInvalidCarrier
+		}
+		_, err := writer.Write(marshalBinary(context))
+		return err
+	}
+	return opentracing.ErrUnsupportedFormat
+}
+
+// Extract reads a span context written by Inject. A carrier without trace
+// context yields opentracing.ErrSpanContextNotFound.
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	switch format {
+	case opentracing.TextMap, opentracing.HTTPHeaders:
+		reader, ok := carrier.(opentracing.TextMapReader)
+		if !ok {
+			return nil, opentracing.ErrInvalidCarrier
+		}
+		headers := make(map[string]string)
+		var baggage map[string]string
+		err := reader.ForeachKey(func(key, value string) error {
+			lowerKey := strings.ToLower(key)
+			if !strings.HasPrefix(lowerKey, baggagePrefix) {
+				headers[key] = value
+				return nil
+			}
+			if format == opentracing.HTTPHeaders {
+				unescaped, err := url.QueryUnescape(value)
+				if err != nil {
+					return opentracing.ErrSpanContextCorrupted
+				}
+				value = unescaped
+			}
+			if baggage == nil {
+				baggage = make(map[string]string)
+			}
+			baggage[strings.TrimPrefix(lowerKey, baggagePrefix)] = value
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		context, err := t.tracer.Extract(headers)
+		switch err {
+		case nil:
+			return spanContext{SpanContext: *context, baggage: baggage}, nil
+		case zipkin.ErrSpanContextNotFound:
+			return nil, opentracing.ErrSpanContextNotFound
+		case zipkin.ErrUnsupportedCarrier:
+			return nil, err
+		}
+		return nil, opentracing.ErrSpanContextCorrupted
+	case opentracing.Binary:
+		reader, ok := carrier.(io.Reader)
+		if !ok {
+			return nil, opentracing.ErrInvalidCarrier
+		}
+		return unmarshalBinary(reader)
+	}
+	return nil, opentracing.ErrUnsupportedFormat
+}
+
+// marshalBinary encodes the flags byte, the big endian trace, span and
+// optional parent ids, and the number of baggage items followed by their
+// length prefixed keys and values.
+func marshalBinary(context spanContext) []byte {
+	var flags byte
+	if context.Sampled != nil {
+		flags |= flagSampledSet
+		if *context.Sampled {
+			flags |= flagSampled
+		}
+	}
+	if context.Debug {
+		flags |= flagDebug
+	}
+	if context.ParentID != nil {
+		flags |= flagParent
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte(flags)
+	binary.Write(buffer, binary.BigEndian, context.TraceID)
+	binary.Write(buffer, binary.BigEndian, context.SpanID)
+	if context.ParentID != nil {
+		binary.Write(buffer, binary.BigEndian, *context.ParentID)
+	}
+	binary.Write(buffer, binary.BigEndian, uint32(len(context.baggage)))
+	for key, value := range context.baggage {
+		writeString(buffer, key)
+		writeString(buffer, value)
+	}
+	return buffer.Bytes()
+}
+
+func writeString(buffer *bytes.Buffer, value string) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(value)))
+	buffer.WriteString(value)
+}
+
+func unmarshalBinary(reader io.Reader) (opentracing.SpanContext, error) {
+	var flags [1]byte
+	if _, err := io.ReadFull(reader, flags[:]); err != nil {
+		if err == io.EOF {
+			return nil, opentracing.ErrSpanContextNotFound
+		}
+		return nil, err
+	}
+
+	context := spanContext{}
+	if flags[0]&flagSampledSet != 0 {
+		sampled := flags[0]&flagSampled != 0
+		context.Sampled = &sampled
+	}
+	context.Debug = flags[0]&flagDebug != 0
+	if err := readBinary(reader, &context.TraceID); err != nil {
+		return nil, err
+	}
+	if err := readBinary(reader, &context.SpanID); err != nil {
+		return nil, err
+	}
+	if flags[0]&flagParent != 0 {
+		var parentID int64
+		if err := readBinary(reader, &parentID); err != nil {
+			return nil, err
+		}
+		context.ParentID = &parentID
+	}
+
+	var items uint32
+	if err := readBinary(reader, &items); err != nil {
+		return nil, err
+	}
+	if items > 0 {
+		context.baggage = make(map[string]string)
+	}
+	for i := uint32(0); i < items; i++ {
+		key, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString(reader)
+		if err != nil {
+			return nil, err
+		}
+		context.baggage[key] = value
+	}
+	return context, nil
+}
+
+func readString(reader io.Reader) (string, error) {
+	var size uint32
+	if err := readBinary(reader, &size); err != nil {
+		return "", err
+	}
+	if size > maxBaggageItemSize {
+		return "", opentracing.ErrSpanContextCorrupted
+	}
+	value := make([]byte, size)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return "", opentracing.ErrSpanContextCorrupted
+	}
+	return string(value), nil
+}
+
+// readBinary reads a big endian value, a truncated carrier is corrupted.
+func readBinary(reader io.Reader, value interface{}) error {
+	if err := binary.Read(reader, binary.BigEndian, value); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return opentracing.ErrSpanContextCorrupted
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package zipkinot
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+const defaultComponent = "opentracing"
+
+// spanContext is the opentracing.SpanContext of the spans of this package.
+type spanContext struct {
+	zipkin.SpanContext
+	baggage map[string]string
+}
+
+func (c spanContext) ForeachBaggageItem(handler func(k, v string) bool) {
+	for k, v := range c.baggage {
+		if !handler(k, v) {
+			return
+		}
+	}
+}
+
+type span struct {
+	tracer *Tracer
+	span   *zipkin.Span
+	start  time.Time
+
+	lock      sync.Mutex
+	baggage   map[string]string // copied on write, contexts share it
+	kind      string
+	component string
+	peer      peer
+	finished  bool
+}
+
+// peer collects the peer.* tags, recorded as remote address at Finish.
+type peer struct {
+	service  string
+	hostname string
+	ip       string
+	port     int16
+}
+
+func (s *span) Context() opentracing.SpanContext {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return spanContext{SpanContext: s.span.Context(), baggage: s.baggage}
+}
+
+func (s *span) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *span) SetOperationName(operationName string) opentracing.Span {
+	s.span.SetName(operationName)
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) opentracing.Span {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch key {
+	case string(ext.SpanKind):
+		s.kind = fmt.Sprint(value)
+	case string(ext.Component):
+		s.component = fmt.Sprint(value)
+	case string(ext.PeerService):
+		s.peer.service = fmt.Sprint(value)
+	case string(ext.PeerHostname):
+		s.peer.hostname = fmt.Sprint(value)
+	case string(ext.PeerHostIPv4):
+		if ip, ok := value.(uint32); ok {
+			s.peer.ip = net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)).String()
+		} else {
+			s.peer.ip = fmt.Sprint(value)
+		}
+	case string(ext.PeerPort):
+		switch port := value.(type) {
+		case uint16:
+			s.peer.port = int16(port)
+		case int:
+			s.peer.port = int16(port)
+		default:
+			s.span.TagValue(key, value)
+		}
+	case string(ext.Error):
+		if errored, ok := value.(bool); ok {
+			if errored {
+				s.span.Tag(key, "true")
+			}
+		} else {
+			s.span.Tag(key, fmt.Sprint(value))
+		}
+	default:
+		s.span.TagValue(key, value)
+	}
+	return s
+}
+
+func (s *span) SetBaggageItem(key, value string) opentracing.Span {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	baggage := make(map[string]string, len(s.baggage)+1)
+	for k, v := range s.baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	s.baggage = baggage
+	return s
+}
+
+func (s *span) BaggageItem(key string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.baggage[key]
+}
+
+// LogFields records an annotation with the fields formatted as key=value
+// pairs, or with just the value of a single event field.
+func (s *span) LogFields(fields ...otlog.Field) {
+	s.span.AnnotateAt(formatFields(fields), time.Now())
+}
+
+func (s *span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := otlog.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		s.LogFields(otlog.Error(err), otlog.String("function", "LogKV"))
+		return
+	}
+	s.LogFields(fields...)
+}
+
+func (s *span) LogEvent(event string) {
+	s.LogFields(otlog.String("event", event))
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.LogFields(otlog.String("event", event), otlog.Object("payload", payload))
+}
+
+func (s *span) Log(data opentracing.LogData) {
+	s.annotateRecord(data.ToLogRecord(), time.Now())
+}
+
+func (s *span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+// FinishWithOptions records the core annotations, timestamp and duration of
+// the span and collects it. Only the first call has an effect.
+func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
+	finish := opts.FinishTime
+	if finish.IsZero() {
+		finish = time.Now()
+	}
+	s.lock.Lock()
+	if s.finished {
+		s.lock.Unlock()
+		return
+	}
+	s.finished = true
+	kind, component, remote := s.kind, s.component, s.peer
+	s.lock.Unlock()
+
+	for _, record := range opts.LogRecords {
+		s.annotateRecord(record, finish)
+	}
+	for _, data := range opts.BulkLogData {
+		s.annotateRecord(data.ToLogRecord(), finish)
+	}
+
+	addressKey := ""
+	switch kind {
+	case string(ext.SpanKindRPCClientEnum):
+		s.span.AnnotateAt(zipkincore.CLIENT_SEND, s.start)
+		s.span.AnnotateAt(zipkincore.CLIENT_RECV, finish)
+		addressKey = zipkincore.SERVER_ADDR
+	case string(ext.SpanKindRPCServerEnum):
+		s.span.AnnotateAt(zipkincore.SERVER_RECV, s.start)
+		s.span.AnnotateAt(zipkincore.SERVER_SEND, finish)
+		addressKey = zipkincore.CLIENT_ADDR
+	case string(ext.SpanKindProducerEnum):
+		s.span.AnnotateAt(zipkin.MessageSend, s.start)
+		addressKey = zipkin.MessageAddr
+	case string(ext.SpanKindConsumerEnum):
+		s.span.AnnotateAt(zipkin.MessageRecv, s.start)
+		addressKey = zipkin.MessageAddr
+	default:
+		if component == "" {
+			component = defaultComponent
+		}
+		s.span.Tag(zipkincore.LOCAL_COMPONENT, component)
+		component = ""
+	}
+	if component != "" {
+		s.span.Tag(string(ext.Component), component)
+	}
+	if addressKey != "" && remote != (peer{}) {
+		serviceName := remote.service
+		if serviceName == "" {
+			serviceName = remote.hostname
+		}
+		s.span.AnnotateAddress(addressKey, serviceName, remote.ip, remote.port)
+	}
+	s.span.SetTimestamp(s.start, finish.Sub(s.start))
+	s.span.Collect()
+}
+
+// annotateRecord records a log record, at the given time if it has no timestamp.
+func (s *span) annotateRecord(record opentracing.LogRecord, timestamp time.Time) {
+	if !record.Timestamp.IsZero() {
+		timestamp = record.Timestamp
+	}
+	s.span.AnnotateAt(formatFields(record.Fields), timestamp)
+}
+
+func formatFields(fields []otlog.Field) string {
+	if len(fields) == 1 && fields[0].Key() == "event" {
+		return fmt.Sprint(fields[0].Value())
+	}
+	pairs := make([]string, len(fields))
+	for i, field := range fields {
+		pairs[i] = field.Key() + "=" + fmt.Sprint(field.Value())
+	}
+	return strings.Join(pairs, " ")
+}
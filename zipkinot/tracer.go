@@ -0,0 +1,70 @@
+// Package zipkinot implements the opentracing-go API on top of go-zipkin, so
+// that code and libraries instrumented with OpenTracing report their spans
+// through a zipkin.Tracer and its collector.
+//
+// The span.kind tag decides the core annotations recorded at Finish: cs/cr
+// for client, sr/ss for server, ms for producer and mr for consumer spans.
+// Spans of any other kind are local spans and get an lc binary annotation
+// with the component tag, or "opentracing" if there is none. Zipkin knows a
+// single parent per span, so a FollowsFrom reference is recorded as parent
+// just like ChildOf, the first ChildOf reference being preferred.
+package zipkinot
+
+import (
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// Tracer is an opentracing.Tracer creating its spans with a zipkin.Tracer.
+type Tracer struct {
+	tracer *zipkin.Tracer
+}
+
+func NewTracer(tracer *zipkin.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	options := opentracing.StartSpanOptions{}
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+
+	var parent *spanContext
+	var parentType opentracing.SpanReferenceType
+	var baggage map[string]string
+	for _, ref := range options.References {
+		context, ok := ref.ReferencedContext.(spanContext)
+		if !ok {
+			continue
+		}
+		if parent == nil || (parentType != opentracing.ChildOfRef && ref.Type == opentracing.ChildOfRef) {
+			parent = &context
+			parentType = ref.Type
+		}
+		for key, value := range context.baggage {
+			if baggage == nil {
+				baggage = make(map[string]string)
+			}
+			baggage[key] = value
+		}
+	}
+
+	var zipkinSpan *zipkin.Span
+	if parent != nil {
+		zipkinSpan = t.tracer.NewChildSpan(operationName, parent.SpanContext)
+	} else {
+		zipkinSpan = t.tracer.NewSpan(operationName)
+	}
+	start := options.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	s := &span{tracer: t, span: zipkinSpan, start: start, baggage: baggage}
+	for key, value := range options.Tags {
+		s.SetTag(key, value)
+	}
+	return s
+}
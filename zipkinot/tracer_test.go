@@ -0,0 +1,159 @@
+package zipkinot
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/go-zipkin/zipkintest"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+func newTestTracer() (*Tracer, *zipkintest.RecordingCollector) {
+	tracer, recorder := zipkintest.NewTracer("service")
+	return NewTracer(tracer), recorder
+}
+
+func hasBinaryAnnotation(span *zipkincore.Span, key string) bool {
+	for _, annotation := range span.BinaryAnnotations {
+		if annotation.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStartSpanReferences(t *testing.T) {
+	tracer, recorder := newTestTracer()
+
+	parent := tracer.StartSpan("parent")
+	parent.SetBaggageItem("user", "alice")
+	follows := tracer.StartSpan("follows")
+	follows.SetBaggageItem("tenant", "acme")
+	child := tracer.StartSpan("child", opentracing.FollowsFrom(follows.Context()),
+		opentracing.ChildOf(parent.Context()))
+	if user, tenant := child.BaggageItem("user"), child.BaggageItem("tenant"); user != "alice" || tenant != "acme" {
+		t.Errorf("Child baggage is user %q, tenant %q, want both parents' items", user, tenant)
+	}
+	onlyFollows := tracer.StartSpan("only-follows", opentracing.FollowsFrom(follows.Context()))
+	root := tracer.StartSpan("root")
+	for _, span := range []opentracing.Span{root, onlyFollows, child, follows, parent} {
+		span.Finish()
+	}
+
+	zipkintest.AssertChildOf(t, recorder.RequireSpan(t, "parent"), recorder.RequireSpan(t, "child"))
+	zipkintest.AssertChildOf(t, recorder.RequireSpan(t, "follows"), recorder.RequireSpan(t, "only-follows"))
+	zipkintest.AssertRoot(t, recorder.RequireSpan(t, "root"))
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	tracer, _ := newTestTracer()
+	span := tracer.StartSpan("span")
+	span.SetBaggageItem("user", "alice smith&co")
+	defer span.Finish()
+	context := span.Context().(spanContext)
+
+	for name, carrier := range map[opentracing.BuiltinFormat]func() (interface{}, interface{}){
+		opentracing.TextMap: func() (interface{}, interface{}) {
+			carrier := opentracing.TextMapCarrier{}
+			return carrier, carrier
+		},
+		opentracing.HTTPHeaders: func() (interface{}, interface{}) {
+			carrier := opentracing.HTTPHeadersCarrier(http.Header{})
+			return carrier, carrier
+		},
+		opentracing.Binary: func() (interface{}, interface{}) {
+			buffer := &bytes.Buffer{}
+			return buffer, buffer
+		},
+	} {
+		writer, reader := carrier()
+		if err := tracer.Inject(context, name, writer); err != nil {
+			t.Fatalf("%v: %s", name, err)
+		}
+		extracted, err := tracer.Extract(name, reader)
+		if err != nil {
+			t.Fatalf("%v: %s", name, err)
+		}
+		actual := extracted.(spanContext)
+		if actual.TraceID != context.TraceID || actual.SpanID != context.SpanID {
+			t.Errorf("%v: extracted %x/%x, want %x/%x", name, actual.TraceID, actual.SpanID, context.TraceID,
+				context.SpanID)
+		}
+		if actual.Sampled == nil || !*actual.Sampled {
+			t.Errorf("%v: extracted context lost the sampling decision", name)
+		}
+		if !reflect.DeepEqual(actual.baggage, context.baggage) {
+			t.Errorf("%v: extracted baggage %v, want %v", name, actual.baggage, context.baggage)
+		}
+	}
+}
+
+func TestExtractWithoutContext(t *testing.T) {
+	tracer, _ := newTestTracer()
+
+	if _, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier{}); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("Extracted from an empty TextMap: %v", err)
+	}
+	if _, err := tracer.Extract(opentracing.Binary, &bytes.Buffer{}); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("Extracted from an empty Binary carrier: %v", err)
+	}
+	if _, err := tracer.Extract(opentracing.Binary, bytes.NewReader([]byte{0, 1})); err != opentracing.ErrSpanContextCorrupted {
+		t.Errorf("Extracted from a truncated Binary carrier: %v", err)
+	}
+}
+
+func TestSpanKindAnnotations(t *testing.T) {
+	tracer, recorder := newTestTracer()
+
+	for _, test := range []struct {
+		kind        interface{}
+		annotations []string
+		addressKey  string
+	}{
+		{ext.SpanKindRPCClientEnum, []string{zipkincore.CLIENT_SEND, zipkincore.CLIENT_RECV}, zipkincore.SERVER_ADDR},
+		{ext.SpanKindRPCServerEnum, []string{zipkincore.SERVER_RECV, zipkincore.SERVER_SEND}, zipkincore.CLIENT_ADDR},
+		{ext.SpanKindProducerEnum, []string{zipkin.MessageSend}, zipkin.MessageAddr},
+		{ext.SpanKindConsumerEnum, []string{zipkin.MessageRecv}, zipkin.MessageAddr},
+	} {
+		recorder.Reset()
+		span := tracer.StartSpan("span", opentracing.Tags{string(ext.SpanKind): test.kind,
+			string(ext.PeerService): "remote", string(ext.PeerPort): uint16(8080)})
+		span.Finish()
+
+		recorded := recorder.RequireSpan(t, "span")
+		zipkintest.AssertAnnotations(t, recorded, test.annotations...)
+		if !hasBinaryAnnotation(recorded, test.addressKey) {
+			t.Errorf("%v span has no %s address", test.kind, test.addressKey)
+		}
+		if hasBinaryAnnotation(recorded, zipkincore.LOCAL_COMPONENT) {
+			t.Errorf("%v span is recorded as local span", test.kind)
+		}
+	}
+
+	recorder.Reset()
+	tracer.StartSpan("local", opentracing.Tag{Key: string(ext.Component), Value: "cache"}).Finish()
+	local := recorder.RequireSpan(t, "local")
+	zipkintest.AssertBinaryAnnotation(t, local, zipkincore.LOCAL_COMPONENT, "cache")
+	if len(local.Annotations) != 0 {
+		t.Errorf("Local span has core annotations %v", local.Annotations)
+	}
+}
+
+func TestUnsignedTagsAreIntegers(t *testing.T) {
+	tracer, recorder := newTestTracer()
+
+	tracer.StartSpan("span", opentracing.Tag{Key: "retries", Value: uint64(3)}).Finish()
+
+	span := recorder.RequireSpan(t, "span")
+	for _, annotation := range span.BinaryAnnotations {
+		if annotation.Key == "retries" && annotation.AnnotationType != zipkincore.AnnotationType_I64 {
+			t.Errorf("uint64 tag recorded as %s, want I64", annotation.AnnotationType)
+		}
+	}
+	zipkintest.AssertBinaryAnnotation(t, span, "retries", int64(3))
+}
@@ -0,0 +1,316 @@
+// Package zipkinotel exports spans of the OpenTelemetry SDK through go-zipkin
+// collectors, so that services instrumented with OpenTelemetry feed the same
+// pipeline as those using zipkin.Tracer.
+//
+// Span kinds map to the core annotations: cs/cr for client, sr/ss for server,
+// ms for producer and mr for consumer spans, internal spans get an lc binary
+// annotation with the instrumentation scope name. Attributes become typed
+// binary annotations, events annotations and an error status the error tag.
+// Zipkin ids are 64 bits wide, so only the lower half of the 128 bit trace
+// ids is kept. Links have no counterpart and are dropped.
+package zipkinotel
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceNameKey = "service.name"
+	statusCodeKey  = "otel.status_code"
+	scopeNameKey   = "otel.scope.name"
+)
+
+// Attributes naming the remote endpoint, in order of preference.
+var (
+	peerServiceKeys = []string{"peer.service", "messaging.system", "db.system"}
+	peerAddressKeys = []string{"server.address", "client.address", "net.peer.ip", "net.peer.name"}
+	peerPortKeys    = []string{"server.port", "client.port", "net.peer.port"}
+)
+
+var ErrExporterShutdown = errors.New("Exporter is shut down")
+
+type Option func(*Exporter)
+
+// ServiceName sets the service name of the local endpoint, the service.name
+// resource attribute by default.
+func ServiceName(name string) Option {
+	return func(e *Exporter) {
+		e.serviceName = name
+	}
+}
+
+// Endpoint sets the ipv4 address and port of the local endpoint, which are
+// left empty by default.
+func Endpoint(ip string, port int16) Option {
+	return func(e *Exporter) {
+		e.ipv4 = parseIPv4(ip)
+		e.port = port
+	}
+}
+
+// CloseCollector makes Shutdown close the collector if it supports closing.
+// By default the collector is left open, as it is usually shared with a
+// zipkin.Tracer.
+func CloseCollector() Option {
+	return func(e *Exporter) {
+		e.closeCollector = true
+	}
+}
+
+// Exporter is an OpenTelemetry SpanExporter sending spans to a zipkin.Collector.
+type Exporter struct {
+	collector      zipkin.Collector
+	closeCollector bool
+	serviceName    string
+	ipv4           int32
+	port           int16
+
+	lock    sync.RWMutex
+	stopped bool
+}
+
+var _ sdktrace.SpanExporter = &Exporter{}
+
+func NewExporter(collector zipkin.Collector, options ...Option) *Exporter {
+	e := &Exporter{collector: collector}
+	for _, option := range options {
+		option(e)
+	}
+	return e
+}
+
+// ExportSpans converts and collects the spans one by one. Spans failing to
+// be collected are reported in the returned error, the others are still sent.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if e.stopped {
+		return ErrExporterShutdown
+	}
+	failed := 0
+	var collectErr error
+	for _, span := range spans {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := e.collector.Collect(e.ConvertSpan(span)); err != nil {
+			failed++
+			collectErr = err
+		}
+	}
+	if collectErr != nil {
+		return fmt.Errorf("Unable to collect %d of %d spans: %s", failed, len(spans), collectErr)
+	}
+	return nil
+}
+
+// Shutdown stops exporting, later calls of ExportSpans fail with
+// ErrExporterShutdown. The collector is closed only with CloseCollector.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.stopped {
+		return nil
+	}
+	e.stopped = true
+	if !e.closeCollector {
+		return nil
+	}
+	if closer, ok := e.collector.(interface {
+		Close() error
+	}); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ConvertSpan converts an OpenTelemetry span to a zipkin span.
+func (e *Exporter) ConvertSpan(span sdktrace.ReadOnlySpan) *zipkincore.Span {
+	host := &zipkincore.Endpoint{ServiceName: e.serviceName, Ipv4: e.ipv4, Port: e.port}
+	if host.ServiceName == "" {
+		if value, ok := span.Resource().Set().Value(serviceNameKey); ok {
+			host.ServiceName = value.AsString()
+		}
+	}
+
+	spanContext := span.SpanContext()
+	timestamp := micros(span.StartTime().UnixNano())
+	duration := micros(span.EndTime().Sub(span.StartTime()).Nanoseconds())
+	zipkinSpan := &zipkincore.Span{
+		TraceID:           traceID(spanContext.TraceID()),
+		Name:              span.Name(),
+		ID:                spanID(spanContext.SpanID()),
+		Annotations:       make([]*zipkincore.Annotation, 0, len(span.Events())+2),
+		BinaryAnnotations: make([]*zipkincore.BinaryAnnotation, 0, len(span.Attributes())+2),
+		Timestamp:         &timestamp,
+		Duration:          &duration,
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		parentID := spanID(parent.SpanID())
+		zipkinSpan.ParentID = &parentID
+	}
+
+	annotate := func(value string, timestamp int64) {
+		zipkinSpan.Annotations = append(zipkinSpan.Annotations,
+			&zipkincore.Annotation{Timestamp: timestamp, Value: value, Host: host})
+	}
+	tag := func(annotation *zipkincore.BinaryAnnotation) {
+		zipkinSpan.BinaryAnnotations = append(zipkinSpan.BinaryAnnotations, annotation)
+	}
+
+	addressKey := ""
+	end := timestamp + duration
+	switch span.SpanKind() {
+	case trace.SpanKindClient:
+		annotate(zipkincore.CLIENT_SEND, timestamp)
+		annotate(zipkincore.CLIENT_RECV, end)
+		addressKey = zipkincore.SERVER_ADDR
+	case trace.SpanKindServer:
+		annotate(zipkincore.SERVER_RECV, timestamp)
+		annotate(zipkincore.SERVER_SEND, end)
+		addressKey = zipkincore.CLIENT_ADDR
+	case trace.SpanKindProducer:
+		annotate(zipkin.MessageSend, timestamp)
+		addressKey = zipkin.MessageAddr
+	case trace.SpanKindConsumer:
+		annotate(zipkin.MessageRecv, timestamp)
+		addressKey = zipkin.MessageAddr
+	default:
+		tag(zipkin.NewBinaryAnnotation(zipkincore.LOCAL_COMPONENT, span.InstrumentationScope().Name, host))
+	}
+	for _, event := range span.Events() {
+		annotate(formatEvent(event), micros(event.Time.UnixNano()))
+	}
+
+	for _, kv := range span.Attributes() {
+		tag(zipkin.NewBinaryAnnotation(string(kv.Key), attributeValue(kv.Value), host))
+	}
+	if addressKey != "" {
+		if remote := remoteEndpoint(span.Attributes()); remote != nil {
+			tag(&zipkincore.BinaryAnnotation{
+				Key:            addressKey,
+				Value:          []byte{1},
+				AnnotationType: zipkincore.AnnotationType_BOOL,
+				Host:           remote,
+			})
+		}
+	}
+	if name := span.InstrumentationScope().Name; name != "" && addressKey != "" {
+		tag(zipkin.NewBinaryAnnotation(scopeNameKey, name, host))
+	}
+
+	status := span.Status()
+	if status.Code != codes.Unset {
+		tag(zipkin.NewBinaryAnnotation(statusCodeKey, strings.ToUpper(status.Code.String()), host))
+	}
+	if status.Code == codes.Error {
+		description := status.Description
+		if description == "" {
+			description = "true"
+		}
+		tag(zipkin.NewBinaryAnnotation("error", description, host))
+	}
+	return zipkinSpan
+}
+
+func micros(nanos int64) int64 {
+	return nanos / 1000
+}
+
+// traceID keeps the lower 64 bits, as B3 does for 128 bit trace ids.
+func traceID(id trace.TraceID) int64 {
+	return int64(binary.BigEndian.Uint64(id[8:]))
+}
+
+func spanID(id trace.SpanID) int64 {
+	return int64(binary.BigEndian.Uint64(id[:]))
+}
+
+// attributeValue returns scalars for typed binary annotations and slices
+// formatted as JSON arrays.
+func attributeValue(value attribute.Value) interface{} {
+	switch value.Type() {
+	case attribute.BOOL, attribute.INT64, attribute.FLOAT64, attribute.STRING:
+		return value.AsInterface()
+	}
+	return formatValue(value)
+}
+
+func formatValue(value attribute.Value) string {
+	switch value.Type() {
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		if encoded, err := json.Marshal(value.AsInterface()); err == nil {
+			return string(encoded)
+		}
+	}
+	return value.Emit()
+}
+
+// formatEvent returns the event name followed by its attributes as key=value pairs.
+func formatEvent(event sdktrace.Event) string {
+	parts := make([]string, 0, len(event.Attributes)+1)
+	parts = append(parts, event.Name)
+	for _, kv := range event.Attributes {
+		parts = append(parts, string(kv.Key)+"="+formatValue(kv.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// remoteEndpoint builds the remote endpoint from the peer attributes, nil if there are none.
+func remoteEndpoint(attributes []attribute.KeyValue) *zipkincore.Endpoint {
+	values := make(map[string]attribute.Value, len(attributes))
+	for _, kv := range attributes {
+		values[string(kv.Key)] = kv.Value
+	}
+	lookup := func(keys []string) (attribute.Value, bool) {
+		for _, key := range keys {
+			if value, ok := values[key]; ok {
+				return value, true
+			}
+		}
+		return attribute.Value{}, false
+	}
+
+	remote := &zipkincore.Endpoint{}
+	found := false
+	if address, ok := lookup(peerAddressKeys); ok {
+		found = true
+		remote.Ipv4 = parseIPv4(address.Emit())
+		if remote.Ipv4 == 0 {
+			remote.ServiceName = address.Emit()
+		}
+	}
+	if service, ok := lookup(peerServiceKeys); ok {
+		found = true
+		remote.ServiceName = service.Emit()
+	}
+	if port, ok := lookup(peerPortKeys); ok && port.Type() == attribute.INT64 {
+		remote.Port = int16(port.AsInt64())
+	}
+	if !found {
+		return nil
+	}
+	return remote
+}
+
+func parseIPv4(ip string) int32 {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(parsed))
+}
@@ -0,0 +1,119 @@
+package zipkinotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+	"github.com/elodina/go-zipkin/zipkintest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExportSpans(t *testing.T) {
+	recorder := zipkintest.NewRecordingCollector()
+	exporter := NewExporter(recorder, Endpoint("10.0.0.2", 80))
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "orders"))))
+	tracer := provider.Tracer("orders/db")
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, client := tracer.Start(ctx, "call", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("server.address", "10.1.2.3"), attribute.Int("server.port", 443),
+		attribute.Bool("cached", true), attribute.Float64("ratio", 0.5),
+		attribute.StringSlice("tables", []string{"a", "b"})))
+	client.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", 2)))
+	client.SetStatus(codes.Error, "timeout")
+	client.End()
+	_, server := tracer.Start(ctx, "handle", trace.WithSpanKind(trace.SpanKindServer))
+	server.End()
+	root.End()
+
+	recorder.RequireSpans(t, 3, time.Second)
+	rootSpan, clientSpan := recorder.RequireSpan(t, "root"), recorder.RequireSpan(t, "call")
+	serverSpan := recorder.RequireSpan(t, "handle")
+	zipkintest.AssertRoot(t, rootSpan)
+	zipkintest.AssertChildOf(t, rootSpan, clientSpan)
+	zipkintest.AssertChildOf(t, rootSpan, serverSpan)
+	zipkintest.AssertAnnotations(t, clientSpan, zipkincore.CLIENT_SEND, "retry attempt=2", zipkincore.CLIENT_RECV)
+	zipkintest.AssertAnnotations(t, serverSpan, zipkincore.SERVER_RECV, zipkincore.SERVER_SEND)
+	zipkintest.AssertBinaryAnnotation(t, rootSpan, zipkincore.LOCAL_COMPONENT, "orders/db")
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, "server.port", int64(443))
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, "cached", true)
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, "ratio", 0.5)
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, "tables", `["a","b"]`)
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, "error", "timeout")
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, statusCodeKey, "ERROR")
+	zipkintest.AssertBinaryAnnotation(t, clientSpan, zipkincore.SERVER_ADDR, true)
+
+	host := clientSpan.Annotations[0].Host
+	if host.ServiceName != "orders" || host.Ipv4 != 0x0a000002 || host.Port != 80 {
+		t.Errorf("Unexpected local endpoint %v", host)
+	}
+	for _, annotation := range clientSpan.BinaryAnnotations {
+		if annotation.Key == zipkincore.SERVER_ADDR && (annotation.Host.Ipv4 != 0x0a010203 || annotation.Host.Port != 443) {
+			t.Errorf("Unexpected remote endpoint %v", annotation.Host)
+		}
+	}
+	if clientSpan.Timestamp == nil || clientSpan.Duration == nil || *clientSpan.Duration < 0 {
+		t.Errorf("Span timestamp %v and duration %v not set", clientSpan.Timestamp, clientSpan.Duration)
+	}
+}
+
+type closingCollector struct {
+	err    error
+	closed bool
+}
+
+func (c *closingCollector) Collect(span *zipkincore.Span) error {
+	return c.err
+}
+
+func (c *closingCollector) Close() error {
+	c.closed = true
+	return nil
+}
+
+func finishedSpan() sdktrace.ReadOnlySpan {
+	provider := sdktrace.NewTracerProvider()
+	_, span := provider.Tracer("test").Start(context.Background(), "span")
+	span.End()
+	return span.(sdktrace.ReadOnlySpan)
+}
+
+func TestExportSpansReportsFailures(t *testing.T) {
+	exporter := NewExporter(&closingCollector{err: errors.New("down")})
+	span := finishedSpan()
+	err := exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span, span})
+	if err == nil || err.Error() != "Unable to collect 2 of 2 spans: down" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	collector := &closingCollector{}
+	exporter := NewExporter(collector)
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if collector.closed {
+		t.Error("Shutdown closed a collector it does not own")
+	}
+	err := exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{finishedSpan()})
+	if err != ErrExporterShutdown {
+		t.Errorf("Expected ErrExporterShutdown, got %v", err)
+	}
+
+	collector = &closingCollector{}
+	if err := NewExporter(collector, CloseCollector()).Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !collector.closed {
+		t.Error("Shutdown with CloseCollector left the collector open")
+	}
+}
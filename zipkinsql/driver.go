@@ -0,0 +1,398 @@
+// Package zipkinsql wraps database/sql drivers to record client spans for
+// statements executed with a context carrying a span, see zipkin.NewContext.
+package zipkinsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+const (
+	queryKey        = "sql.query"
+	rowsKey         = "sql.rows"
+	rowsAffectedKey = "sql.rows_affected"
+)
+
+type Option func(*tracedDriver)
+
+// ServiceName sets the service name of the database in the sa endpoint, "db" by default.
+func ServiceName(name string) Option {
+	return func(d *tracedDriver) {
+		d.serviceName = name
+	}
+}
+
+// Sanitize rewrites statements before they are tagged, e.g. SanitizeLiterals
+// to keep values out of traces. Statements are tagged as they are by default.
+func Sanitize(sanitize func(query string) string) Option {
+	return func(d *tracedDriver) {
+		d.sanitize = sanitize
+	}
+}
+
+// Register registers the wrapped driver with database/sql under name.
+func Register(name string, d driver.Driver, options ...Option) {
+	sql.Register(name, Wrap(d, options...))
+}
+
+// Wrap returns a driver recording a child span of the context's span for
+// every Exec, Query, Prepare, Begin, Commit and Rollback. Calls without a
+// span in their context, including the context-less ones, are not traced.
+func Wrap(d driver.Driver, options ...Option) driver.Driver {
+	td := &tracedDriver{driver: d, serviceName: "db"}
+	for _, option := range options {
+		option(td)
+	}
+	return td
+}
+
+type tracedDriver struct {
+	driver      driver.Driver
+	serviceName string
+	sanitize    func(query string) string
+}
+
+func (d *tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn: conn, driver: d}, nil
+}
+
+// startSpan returns nil if the context carries no span.
+func (d *tracedDriver) startSpan(ctx context.Context, name string, query string) *zipkin.Span {
+	parent := zipkin.SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	span := parent.NewChild(name)
+	if query != "" {
+		if d.sanitize != nil {
+			query = d.sanitize(query)
+		}
+		span.Tag(queryKey, query)
+	}
+	span.AnnotateAddress(zipkincore.SERVER_ADDR, d.serviceName, "", 0)
+	span.ClientSend()
+	return span
+}
+
+// finishSpan collects the span unless the driver skipped the call, so that
+// database/sql retries it another way.
+func finishSpan(span *zipkin.Span, err error) {
+	if span == nil || err == driver.ErrSkip {
+		return
+	}
+	if err != nil {
+		span.Tag("error", err.Error())
+	}
+	span.ClientReceiveAndCollect()
+}
+
+type tracedConn struct {
+	conn   driver.Conn
+	driver *tracedDriver
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	span := c.driver.startSpan(ctx, "prepare", query)
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	finishSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{stmt: stmt, query: query, driver: c.driver}, nil
+}
+
+func (c *tracedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tracedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	span := c.driver.startSpan(ctx, "begin", "")
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		err = errors.New("Driver does not support transaction options")
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	finishSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{tx: tx, ctx: ctx, driver: c.driver}, nil
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.driver.startSpan(ctx, "exec", query)
+	result, err := execer.ExecContext(ctx, query, args)
+	tagResult(span, result, err)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.driver.startSpan(ctx, "query", query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil || span == nil {
+		finishSpan(span, err)
+		return rows, err
+	}
+	return &tracedRows{rows: rows, span: span}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type tracedStmt struct {
+	stmt   driver.Stmt
+	query  string
+	driver *tracedDriver
+}
+
+func (s *tracedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *tracedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *tracedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *tracedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	span := s.driver.startSpan(ctx, "exec", s.query)
+	var result driver.Result
+	var err error
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.stmt.Exec(values)
+		}
+	}
+	tagResult(span, result, err)
+	finishSpan(span, err)
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	span := s.driver.startSpan(ctx, "query", s.query)
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.stmt.Query(values)
+		}
+	}
+	if err != nil || span == nil {
+		finishSpan(span, err)
+		return rows, err
+	}
+	return &tracedRows{rows: rows, span: span}, nil
+}
+
+func (s *tracedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+// ColumnConverter returns the driver's converter for argument idx, or the
+// default one database/sql uses for statements without.
+func (s *tracedStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if converter, ok := s.stmt.(driver.ColumnConverter); ok {
+		return converter.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+type tracedTx struct {
+	tx     driver.Tx
+	ctx    context.Context
+	driver *tracedDriver
+}
+
+func (t *tracedTx) Commit() error {
+	span := t.driver.startSpan(t.ctx, "commit", "")
+	err := t.tx.Commit()
+	finishSpan(span, err)
+	return err
+}
+
+func (t *tracedTx) Rollback() error {
+	span := t.driver.startSpan(t.ctx, "rollback", "")
+	err := t.tx.Rollback()
+	finishSpan(span, err)
+	return err
+}
+
+// tracedRows counts the rows read and ends the query span when closed.
+type tracedRows struct {
+	rows  driver.Rows
+	span  *zipkin.Span
+	count int
+	err   error
+}
+
+func (r *tracedRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) HasNextResultSet() bool {
+	if sets, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return sets.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *tracedRows) NextResultSet() error {
+	if sets, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return sets.NextResultSet()
+	}
+	return io.EOF
+}
+
+// The column type methods return what database/sql reports for drivers
+// without them.
+
+func (r *tracedRows) ColumnTypeScanType(index int) reflect.Type {
+	if types, ok := r.rows.(driver.RowsColumnTypeScanType); ok {
+		return types.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *tracedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if types, ok := r.rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return types.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *tracedRows) ColumnTypeLength(index int) (int64, bool) {
+	if types, ok := r.rows.(driver.RowsColumnTypeLength); ok {
+		return types.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *tracedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if types, ok := r.rows.(driver.RowsColumnTypeNullable); ok {
+		return types.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *tracedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if types, ok := r.rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return types.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+func (r *tracedRows) Close() error {
+	err := r.rows.Close()
+	if r.span != nil {
+		r.span.Tag(rowsKey, strconv.Itoa(r.count))
+		if r.err == nil {
+			r.err = err
+		}
+		finishSpan(r.span, r.err)
+		r.span = nil
+	}
+	return err
+}
+
+func tagResult(span *zipkin.Span, result driver.Result, err error) {
+	if span == nil || err != nil || result == nil {
+		return
+	}
+	if affected, err := result.RowsAffected(); err == nil {
+		span.Tag(rowsAffectedKey, strconv.FormatInt(affected, 10))
+	}
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("Driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,287 @@
+package zipkinsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/zipkintest"
+)
+
+// fakeDriver serves two result sets of one int column for every query and
+// records the arguments of prepared statements.
+type fakeDriver struct {
+	execArgs []driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: d}, nil
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{driver: c.driver}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(2), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{sets: [][]int64{{1, 2}, {3}}}, nil
+}
+
+// fakeStmt upper cases its string arguments with its column converter.
+type fakeStmt struct {
+	driver *fakeDriver
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return 1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.execArgs = args
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (s *fakeStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return upperConverter{}
+}
+
+type upperConverter struct{}
+
+func (upperConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if s, ok := v.(string); ok {
+		return strings.ToUpper(s), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	sets [][]int64
+	row  int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.sets) == 0 || r.row >= len(r.sets[0]) {
+		return io.EOF
+	}
+	dest[0] = r.sets[0][r.row]
+	r.row++
+	return nil
+}
+
+func (r *fakeRows) HasNextResultSet() bool {
+	return len(r.sets) > 1
+}
+
+func (r *fakeRows) NextResultSet() error {
+	if len(r.sets) <= 1 {
+		return io.EOF
+	}
+	r.sets, r.row = r.sets[1:], 0
+	return nil
+}
+
+func (r *fakeRows) ColumnTypeScanType(index int) reflect.Type {
+	return reflect.TypeOf(int64(0))
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	return "BIGINT"
+}
+
+func (r *fakeRows) ColumnTypeLength(index int) (int64, bool) {
+	return 8, true
+}
+
+func (r *fakeRows) ColumnTypeNullable(index int) (bool, bool) {
+	return true, true
+}
+
+func (r *fakeRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return 19, 0, true
+}
+
+type connector struct {
+	driver driver.Driver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+func newTestDB(t *testing.T, options ...Option) (*sql.DB, *fakeDriver, context.Context, *zipkintest.RecordingCollector) {
+	fake := &fakeDriver{}
+	db := sql.OpenDB(connector{Wrap(fake, options...)})
+	t.Cleanup(func() { db.Close() })
+	tracer, recorder := zipkintest.NewTracer("service")
+	return db, fake, zipkin.NewContext(context.Background(), tracer.NewSpan("request")), recorder
+}
+
+func TestQueryRecordsSpan(t *testing.T) {
+	db, _, ctx, recorder := newTestDB(t)
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for {
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Errorf("Read ids %v from both result sets, want [1 2 3]", ids)
+	}
+
+	span := recorder.RequireSpan(t, "query")
+	zipkintest.AssertAnnotations(t, span, "cs", "cr")
+	zipkintest.AssertBinaryAnnotation(t, span, queryKey, "SELECT id FROM orders")
+	zipkintest.AssertBinaryAnnotation(t, span, rowsKey, "3")
+}
+
+func TestQueryWithoutSpanIsNotTraced(t *testing.T) {
+	db, _, _, recorder := newTestDB(t)
+
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM orders"); err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Spans(); len(spans) != 0 {
+		t.Errorf("Recorded %d spans without a span in the context", len(spans))
+	}
+}
+
+func TestExecRecordsSanitizedQuery(t *testing.T) {
+	db, _, ctx, recorder := newTestDB(t, Sanitize(SanitizeLiterals))
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM orders WHERE id = 42"); err != nil {
+		t.Fatal(err)
+	}
+
+	span := recorder.RequireSpan(t, "exec")
+	zipkintest.AssertBinaryAnnotation(t, span, queryKey, "DELETE FROM orders WHERE id = ?")
+	zipkintest.AssertBinaryAnnotation(t, span, rowsAffectedKey, "2")
+}
+
+func TestColumnTypesAreForwarded(t *testing.T) {
+	db, _, ctx, _ := newTestDB(t)
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	column := types[0]
+	if name := column.DatabaseTypeName(); name != "BIGINT" {
+		t.Errorf("Database type name %q, want BIGINT", name)
+	}
+	if scanType := column.ScanType(); scanType != reflect.TypeOf(int64(0)) {
+		t.Errorf("Scan type %v, want int64", scanType)
+	}
+	if length, ok := column.Length(); !ok || length != 8 {
+		t.Errorf("Length %d, %v, want 8, true", length, ok)
+	}
+	if nullable, ok := column.Nullable(); !ok || !nullable {
+		t.Errorf("Nullable %v, %v, want true, true", nullable, ok)
+	}
+	if precision, scale, ok := column.DecimalSize(); !ok || precision != 19 || scale != 0 {
+		t.Errorf("Decimal size %d, %d, %v, want 19, 0, true", precision, scale, ok)
+	}
+}
+
+func TestPreparedStatementUsesColumnConverter(t *testing.T) {
+	db, fake, ctx, recorder := newTestDB(t)
+
+	stmt, err := db.PrepareContext(ctx, "UPDATE orders SET state = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	if _, err := stmt.ExecContext(ctx, "shipped"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fake.execArgs, []driver.Value{"SHIPPED"}) {
+		t.Errorf("Statement executed with %v, want the converted [SHIPPED]", fake.execArgs)
+	}
+	recorder.RequireSpan(t, "prepare")
+	zipkintest.AssertBinaryAnnotation(t, recorder.RequireSpan(t, "exec"), rowsAffectedKey, "1")
+}
+
+func TestTransactionRecordsSpans(t *testing.T) {
+	db, _, ctx, recorder := newTestDB(t)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	zipkintest.AssertAnnotations(t, recorder.RequireSpan(t, "begin"), "cs", "cr")
+	zipkintest.AssertAnnotations(t, recorder.RequireSpan(t, "commit"), "cs", "cr")
+}
@@ -0,0 +1,169 @@
+package zipkintest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// RequireSpan fails the test unless a span with the given name was collected.
+func (rc *RecordingCollector) RequireSpan(t testing.TB, name string) *zipkincore.Span {
+	t.Helper()
+	span := rc.FindSpan(name)
+	if span == nil {
+		t.Fatalf("No span named %q among %d collected spans", name, len(rc.Spans()))
+	}
+	return span
+}
+
+// RequireSpans waits for n spans and fails the test if they don't arrive in time.
+func (rc *RecordingCollector) RequireSpans(t testing.TB, n int, timeout time.Duration) []*zipkincore.Span {
+	t.Helper()
+	spans, err := rc.WaitForSpans(n, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
+
+func AssertChildOf(t testing.TB, parent, child *zipkincore.Span) {
+	t.Helper()
+	if child.TraceID != parent.TraceID {
+		t.Errorf("Span %q has trace id %x, parent %q has %x", child.Name, child.TraceID, parent.Name, parent.TraceID)
+	}
+	if child.ParentID == nil {
+		t.Errorf("Span %q has no parent, expected %q", child.Name, parent.Name)
+	} else if *child.ParentID != parent.ID {
+		t.Errorf("Span %q has parent id %x, expected %x of %q", child.Name, *child.ParentID, parent.ID, parent.Name)
+	}
+}
+
+func AssertRoot(t testing.TB, span *zipkincore.Span) {
+	t.Helper()
+	if span.ParentID != nil {
+		t.Errorf("Span %q has parent id %x, expected a root span", span.Name, *span.ParentID)
+	}
+}
+
+// AssertAnnotations checks that the span carries the given annotations with
+// non-decreasing timestamps in the given order.
+func AssertAnnotations(t testing.TB, span *zipkincore.Span, values ...string) {
+	t.Helper()
+	var previous *zipkincore.Annotation
+	for _, value := range values {
+		annotation := findAnnotation(span, value)
+		if annotation == nil {
+			t.Errorf("Span %q has no %q annotation", span.Name, value)
+			return
+		}
+		if previous != nil && annotation.Timestamp < previous.Timestamp {
+			t.Errorf("Span %q annotation %q at %d precedes %q at %d", span.Name, value, annotation.Timestamp,
+				previous.Value, previous.Timestamp)
+		}
+		previous = annotation
+	}
+}
+
+// AssertCoreAnnotationOrder checks that whichever of cs, sr, ss and cr the
+// span carries are ordered cs <= sr <= ss <= cr.
+func AssertCoreAnnotationOrder(t testing.TB, span *zipkincore.Span) {
+	t.Helper()
+	var present []string
+	for _, value := range []string{zipkincore.CLIENT_SEND, zipkincore.SERVER_RECV, zipkincore.SERVER_SEND,
+		zipkincore.CLIENT_RECV} {
+		if findAnnotation(span, value) != nil {
+			present = append(present, value)
+		}
+	}
+	if len(present) == 0 {
+		t.Errorf("Span %q has none of the cs, sr, ss, cr annotations", span.Name)
+		return
+	}
+	AssertAnnotations(t, span, present...)
+}
+
+// AssertBinaryAnnotation checks the decoded value of a binary annotation.
+// The expected value is encoded like zipkin.NewBinaryAnnotation encodes tag
+// values, so an int matches an I64 annotation and a float32 a DOUBLE one.
+func AssertBinaryAnnotation(t testing.TB, span *zipkincore.Span, key string, expected interface{}) {
+	t.Helper()
+	annotation := findBinaryAnnotation(span, key)
+	if annotation == nil {
+		t.Errorf("Span %q has no %q binary annotation", span.Name, key)
+		return
+	}
+	actual, err := BinaryAnnotationValue(annotation)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected, err = BinaryAnnotationValue(zipkin.NewBinaryAnnotation(key, expected, nil))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Span %q binary annotation %q is %v (%T), expected %v (%T)", span.Name, key, actual, actual,
+			expected, expected)
+	}
+}
+
+// BinaryAnnotationValue decodes a binary annotation value into the Go type
+// matching its annotation type.
+func BinaryAnnotationValue(annotation *zipkincore.BinaryAnnotation) (interface{}, error) {
+	var value interface{}
+	reader := bytes.NewReader(annotation.Value)
+	switch annotation.AnnotationType {
+	case zipkincore.AnnotationType_STRING:
+		return string(annotation.Value), nil
+	case zipkincore.AnnotationType_BYTES:
+		return annotation.Value, nil
+	case zipkincore.AnnotationType_BOOL:
+		if len(annotation.Value) == 1 {
+			return annotation.Value[0] != 0, nil
+		}
+	case zipkincore.AnnotationType_I16:
+		var v int16
+		value = &v
+	case zipkincore.AnnotationType_I32:
+		var v int32
+		value = &v
+	case zipkincore.AnnotationType_I64:
+		var v int64
+		value = &v
+	case zipkincore.AnnotationType_DOUBLE:
+		if len(annotation.Value) == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(annotation.Value)), nil
+		}
+	}
+	if value != nil && binary.Read(reader, binary.BigEndian, value) == nil && reader.Len() == 0 {
+		return reflect.ValueOf(value).Elem().Interface(), nil
+	}
+	return nil, fmt.Errorf("Invalid %s value %v of binary annotation %q", annotation.AnnotationType, annotation.Value,
+		annotation.Key)
+}
+
+func findAnnotation(span *zipkincore.Span, value string) *zipkincore.Annotation {
+	for _, annotation := range span.Annotations {
+		if annotation.Value == value {
+			return annotation
+		}
+	}
+	return nil
+}
+
+func findBinaryAnnotation(span *zipkincore.Span, key string) *zipkincore.BinaryAnnotation {
+	for _, annotation := range span.BinaryAnnotations {
+		if annotation.Key == key {
+			return annotation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package zipkintest
+
+import (
+	"testing"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+func TestAssertBinaryAnnotationNormalizesExpected(t *testing.T) {
+	span := &zipkincore.Span{Name: "span", BinaryAnnotations: []*zipkincore.BinaryAnnotation{
+		zipkin.NewBinaryAnnotation("rows", int64(42), nil),
+		zipkin.NewBinaryAnnotation("ratio", 0.5, nil),
+		zipkin.NewBinaryAnnotation("status", int16(200), nil),
+		zipkin.NewBinaryAnnotation("cached", true, nil),
+	}}
+	AssertBinaryAnnotation(t, span, "rows", 42)
+	AssertBinaryAnnotation(t, span, "ratio", float32(0.5))
+	AssertBinaryAnnotation(t, span, "status", int16(200))
+	AssertBinaryAnnotation(t, span, "cached", true)
+}
+
+func TestRecordingCollectorSnapshotsSpans(t *testing.T) {
+	tracer, collector := NewTracer("service")
+	span := tracer.NewSpan("root")
+	span.Tag("key", "value")
+	if err := span.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	recorded := collector.RequireSpan(t, "root")
+	if recorded.ID != span.ID() || recorded.TraceID != span.TraceID() {
+		t.Errorf("Recorded span %x/%x, collected %x/%x", recorded.TraceID, recorded.ID, span.TraceID(), span.ID())
+	}
+	AssertRoot(t, recorded)
+	AssertBinaryAnnotation(t, recorded, "key", "value")
+}
@@ -0,0 +1,115 @@
+// Package zipkintest provides an in-memory collector and assertion helpers
+// for testing code instrumented with go-zipkin.
+package zipkintest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elodina/go-zipkin"
+	"github.com/elodina/go-zipkin/gen-go/zipkincore"
+)
+
+// RecordingCollector keeps every collected span in memory. Spans are stored
+// as decoded from their binary Thrift form, so recorded spans are snapshots
+// and a span which cannot be serialized fails the Collect call.
+type RecordingCollector struct {
+	lock      sync.Mutex
+	spans     []*zipkincore.Span
+	collected chan struct{}
+}
+
+func NewRecordingCollector() *RecordingCollector {
+	return &RecordingCollector{collected: make(chan struct{})}
+}
+
+// NewTracer returns a tracer sampling every span into a new RecordingCollector.
+func NewTracer(serviceName string) (*zipkin.Tracer, *RecordingCollector) {
+	collector := NewRecordingCollector()
+	tracer := zipkin.NewTracerWithOptions(serviceName, zipkin.WithCollector(collector),
+		zipkin.WithEndpoint("127.0.0.1", zipkin.DefaultPort()))
+	return tracer, collector
+}
+
+func (rc *RecordingCollector) Collect(span *zipkincore.Span) error {
+	bytes, err := zipkin.SerializeSpan(span)
+	if err != nil {
+		return err
+	}
+	recorded, err := zipkin.DeserializeSpan(bytes)
+	if err != nil {
+		return err
+	}
+	rc.lock.Lock()
+	rc.spans = append(rc.spans, recorded)
+	close(rc.collected)
+	rc.collected = make(chan struct{})
+	rc.lock.Unlock()
+	return nil
+}
+
+// Spans returns the spans collected so far in collection order.
+func (rc *RecordingCollector) Spans() []*zipkincore.Span {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	spans := make([]*zipkincore.Span, len(rc.spans))
+	copy(spans, rc.spans)
+	return spans
+}
+
+func (rc *RecordingCollector) Reset() {
+	rc.lock.Lock()
+	rc.spans = nil
+	rc.lock.Unlock()
+}
+
+// WaitForSpans blocks until at least n spans were collected or the timeout
+// expires.
+func (rc *RecordingCollector) WaitForSpans(n int, timeout time.Duration) ([]*zipkincore.Span, error) {
+	deadline := time.After(timeout)
+	for {
+		rc.lock.Lock()
+		count := len(rc.spans)
+		collected := rc.collected
+		rc.lock.Unlock()
+		if count >= n {
+			return rc.Spans(), nil
+		}
+		select {
+		case <-collected:
+		case <-deadline:
+			return rc.Spans(), fmt.Errorf("Collected %d spans, expected %d within %s", count, n, timeout)
+		}
+	}
+}
+
+// FindSpans returns all collected spans with the given name.
+func (rc *RecordingCollector) FindSpans(name string) []*zipkincore.Span {
+	var found []*zipkincore.Span
+	for _, span := range rc.Spans() {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+// FindSpan returns the first collected span with the given name or nil.
+func (rc *RecordingCollector) FindSpan(name string) *zipkincore.Span {
+	if found := rc.FindSpans(name); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// Children returns the collected spans whose parent is the given span.
+func (rc *RecordingCollector) Children(parent *zipkincore.Span) []*zipkincore.Span {
+	var children []*zipkincore.Span
+	for _, span := range rc.Spans() {
+		if span.TraceID == parent.TraceID && span.ParentID != nil && *span.ParentID == parent.ID {
+			children = append(children, span)
+		}
+	}
+	return children
+}
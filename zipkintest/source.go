@@ -0,0 +1,90 @@
+package zipkintest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elodina/siesta"
+)
+
+// MessageSource is an in-memory zipkin.MessageSource for testing a
+// zipkin.KafkaIngester without Kafka.
+type MessageSource struct {
+	// FetchSize limits the messages returned by one Consume call, zero meaning all.
+	FetchSize int
+
+	lock       sync.Mutex
+	partitions map[string][][]byte
+	committed  map[string]int64
+}
+
+func NewMessageSource() *MessageSource {
+	return &MessageSource{
+		partitions: make(map[string][][]byte),
+		committed:  make(map[string]int64),
+	}
+}
+
+// Append adds a message to the partition and returns its offset.
+func (ms *MessageSource) Append(topic string, partition int32, value []byte) int64 {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	key := partitionKey(topic, partition)
+	ms.partitions[key] = append(ms.partitions[key], value)
+	return int64(len(ms.partitions[key]) - 1)
+}
+
+// Committed returns the offset committed by the group and whether there is one.
+func (ms *MessageSource) Committed(group string, topic string, partition int32) (int64, bool) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	offset, ok := ms.committed[group+"/"+partitionKey(topic, partition)]
+	return offset, ok
+}
+
+func (ms *MessageSource) GetOffset(group string, topic string, partition int32) (int64, error) {
+	offset, ok := ms.Committed(group, topic, partition)
+	if !ok {
+		return -1, fmt.Errorf("No offset committed by %s for %s", group, partitionKey(topic, partition))
+	}
+	return offset, nil
+}
+
+func (ms *MessageSource) GetAvailableOffset(topic string, partition int32, offsetTime int64) (int64, error) {
+	if offsetTime == siesta.EarliestTime {
+		return 0, nil
+	}
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return int64(len(ms.partitions[partitionKey(topic, partition)])), nil
+}
+
+func (ms *MessageSource) Consume(topic string, partition int32, offset int64) ([]*siesta.MessageAndMetadata, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	values := ms.partitions[partitionKey(topic, partition)]
+	var messages []*siesta.MessageAndMetadata
+	for i := offset; i < int64(len(values)); i++ {
+		if ms.FetchSize > 0 && len(messages) >= ms.FetchSize {
+			break
+		}
+		messages = append(messages, &siesta.MessageAndMetadata{
+			Value:     values[i],
+			Topic:     topic,
+			Partition: partition,
+			Offset:    i,
+		})
+	}
+	return messages, nil
+}
+
+func (ms *MessageSource) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.committed[group+"/"+partitionKey(topic, partition)] = offset
+	return nil
+}
+
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}